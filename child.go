@@ -0,0 +1,112 @@
+package environ
+
+// Child returns a new, empty Environ layered over e. Reads of keys the
+// child doesn't hold fall through to e, while Set, Unset and the other
+// single-key writes only affect the child: unsetting a key hides the
+// parent's value from the child without touching the parent. AsMap,
+// AsSlice, Keys, Len and the other whole-set reads present the merged
+// view, reflecting later changes to the parent.
+//
+// Operations over the whole set, such as Keep, Drop, Filter, ExpandAll and
+// Clear, first copy the merged view into the child, which from then on no
+// longer reads through to the parent. Clone returns a flat copy of the
+// merged view.
+func (e *Environ) Child() *Environ {
+	c := e.derive(make(map[string]string))
+	c.parent = e
+	c.hidden = make(map[string]bool)
+
+	return c
+}
+
+// layered reports whether reads fall through to a parent, or to the OS for
+// FromOSLazy. The caller must hold a lock.
+func (e *Environ) layered() bool {
+	return (e.parent != nil || e.lazy) && !e.detached
+}
+
+// view returns the merged contents of the Environ and its parents, which
+// the caller must not modify. The caller must hold a lock.
+func (e *Environ) view() map[string]string {
+	if !e.layered() {
+		return e.m
+	}
+
+	var m map[string]string
+	if e.lazy {
+		m = e.osView()
+	} else {
+		m = e.parent.AsMap()
+	}
+
+	for k := range e.hidden {
+		delete(m, k)
+	}
+
+	for k, v := range e.m {
+		m[k] = v
+	}
+
+	return m
+}
+
+// get retrieves key, falling through to the parent. The caller must hold a
+// lock.
+func (e *Environ) get(key string) (string, bool) {
+	if v, ok := e.m[key]; ok || !e.layered() {
+		return v, ok
+	}
+
+	if e.hidden[key] {
+		return "", false
+	}
+
+	if e.lazy {
+		return e.lookupOS(key)
+	}
+
+	return e.parent.GetOK(key)
+}
+
+// put stores key, revealing it if it was hidden. The caller must hold the
+// write lock.
+func (e *Environ) put(key, val string) {
+	if e.ordered {
+		e.track(key)
+	}
+
+	e.m[key] = val
+	delete(e.hidden, key)
+
+	if e.fold {
+		e.folded[foldKey(key)] = key
+	}
+}
+
+// del removes key, hiding the parent's value if there is one. The caller
+// must hold the write lock.
+func (e *Environ) del(key string) {
+	if e.ordered {
+		e.untrack(key)
+	}
+
+	delete(e.m, key)
+
+	if e.layered() {
+		e.hidden[key] = true
+	}
+}
+
+// materialize copies the merged view into the Environ and stops it reading
+// through to its parent, so that it can be modified as a whole. The caller
+// must hold the write lock.
+func (e *Environ) materialize() {
+	if !e.layered() {
+		return
+	}
+
+	e.m = e.view()
+	e.detached = true
+	e.hidden = nil
+	e.reindex()
+}
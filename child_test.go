@@ -0,0 +1,111 @@
+package environ_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/metrumresearchgroup/environ"
+)
+
+func TestChild(t *testing.T) {
+	parent := environ.New([]string{"A=A", "B=B", "C=C"})
+	child := parent.Child()
+
+	child.Set("B", "Bee")
+	child.Set("D", "D")
+	child.Unset("C")
+
+	if got := child.Get("A"); got != "A" {
+		t.Fatalf("expected A to fall through, got: %q", got)
+	}
+
+	if child.Has("C") {
+		t.Fatalf("expected C to be hidden in the child")
+	}
+
+	if !reflect.DeepEqual(child.AsSlice(), []string{"A=A", "B=Bee", "D=D"}) {
+		t.Fatalf("unexpected child slice: %v", child.AsSlice())
+	}
+
+	if child.Len() != 3 {
+		t.Fatalf("unexpected child Len: %d", child.Len())
+	}
+
+	if !reflect.DeepEqual(parent.AsSlice(), []string{"A=A", "B=B", "C=C"}) {
+		t.Fatalf("parent was modified: %v", parent.AsSlice())
+	}
+
+	parent.Set("E", "E")
+	parent.Set("A", "Apple")
+
+	if !reflect.DeepEqual(child.Keys(), []string{"A", "B", "D", "E"}) {
+		t.Fatalf("expected parent changes to show through: %v", child.Keys())
+	}
+
+	if child.Get("A") != "Apple" {
+		t.Fatalf("expected parent changes to show through: %v", child.AsSlice())
+	}
+
+	child.Set("C", "Sea")
+
+	if child.Get("C") != "Sea" || parent.Get("C") != "C" {
+		t.Fatalf("expected C to be revealed in the child only")
+	}
+
+	if !child.Equal(environ.New(child.AsSlice())) {
+		t.Fatalf("expected child to equal its merged view")
+	}
+
+	if added, removed, changed := child.Diff(parent); !reflect.DeepEqual(added, []string{"D"}) || len(removed) != 0 || !reflect.DeepEqual(changed, []string{"B", "C"}) {
+		t.Fatalf("unexpected diff against parent: %v, %v, %v", added, removed, changed)
+	}
+}
+
+func TestChildBulkOperationsDetach(t *testing.T) {
+	parent := environ.New([]string{"A=A", "B=B", "A_X=X"})
+	child := parent.Child()
+	child.Unset("B")
+
+	if _, err := child.Keep("A.*"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	parent.Set("A_Y", "Y")
+
+	if !reflect.DeepEqual(child.AsSlice(), []string{"A=A", "A_X=X"}) {
+		t.Fatalf("unexpected child slice: %v", child.AsSlice())
+	}
+
+	if child.Len() != 2 {
+		t.Fatalf("unexpected child Len: %d", child.Len())
+	}
+
+	if parent.Len() != 4 {
+		t.Fatalf("parent was modified: %v", parent.AsSlice())
+	}
+}
+
+func TestChildCaseInsensitive(t *testing.T) {
+	parent := environ.NewCaseInsensitive([]string{"PATH=/bin", "HOME=/home/me"})
+	child := parent.Child()
+
+	child.Set("path", "/x")
+
+	if !reflect.DeepEqual(child.AsSlice(), []string{"HOME=/home/me", "PATH=/x"}) {
+		t.Fatalf("unexpected child slice: %v", child.AsSlice())
+	}
+
+	child.Unset("home")
+
+	if child.Has("Home") || !parent.Has("home") {
+		t.Fatalf("expected Unset to hide home in the child only")
+	}
+
+	if !reflect.DeepEqual(child.AsSlice(), []string{"PATH=/x"}) {
+		t.Fatalf("unexpected child slice: %v", child.AsSlice())
+	}
+
+	if parent.Get("PATH") != "/bin" {
+		t.Fatalf("parent was modified: %v", parent.AsSlice())
+	}
+}
@@ -0,0 +1,22 @@
+package environ
+
+import (
+	"context"
+)
+
+// contextKey is unexported to prevent collisions with keys from other
+// packages.
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying e, which can be retrieved with
+// FromContext.
+func NewContext(ctx context.Context, e *Environ) context.Context {
+	return context.WithValue(ctx, contextKey{}, e)
+}
+
+// FromContext returns the Environ stored in ctx by NewContext, if any.
+func FromContext(ctx context.Context) (*Environ, bool) {
+	e, ok := ctx.Value(contextKey{}).(*Environ)
+
+	return e, ok
+}
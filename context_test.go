@@ -0,0 +1,26 @@
+package environ_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/metrumresearchgroup/environ"
+)
+
+func TestContext(t *testing.T) {
+	if _, ok := environ.FromContext(context.Background()); ok {
+		t.Fatalf("expected no environ in an empty context")
+	}
+
+	env := environ.New([]string{"A=A"})
+	ctx := environ.NewContext(context.Background(), env)
+
+	got, ok := environ.FromContext(ctx)
+	if !ok {
+		t.Fatalf("expected an environ in the context")
+	}
+
+	if got != env {
+		t.Fatalf("expected the same environ back")
+	}
+}
@@ -0,0 +1,189 @@
+package environ
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// A Document is a .env style file held line by line, so that comments,
+// blank lines and the order of variables survive editing. Setting or
+// unsetting a variable changes only the lines that hold it, and WriteFile
+// writes everything else back as it was read.
+//
+// Lines are parsed with the same rules as LoadFile. A Document isn't safe
+// for concurrent use; take an Environ from it to share between goroutines.
+type Document struct {
+	lines []string
+
+	// ends holds what followed each line: "\n", "\r\n", or for the last
+	// line whatever ended the file. Lines added by Set have no ending of
+	// their own, and take eol, the ending of the first line break read.
+	ends []string
+	eol  string
+}
+
+// LoadDocument reads a .env style file from path into a Document.
+func LoadDocument(path string) (*Document, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading env file: %w", err)
+	}
+
+	return newDocument(string(data)), nil
+}
+
+// ReadDocument reads a .env style file from r into a Document.
+func ReadDocument(r io.Reader) (*Document, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("reading env: %w", err)
+	}
+
+	return newDocument(string(data)), nil
+}
+
+// newDocument splits data into a Document, remembering each line's ending
+// as well as that of the first line break, for lines added later.
+func newDocument(data string) *Document {
+	d := &Document{lines: strings.Split(data, "\n"), eol: "\n"}
+	d.ends = make([]string, len(d.lines))
+
+	for i, line := range d.lines {
+		if strings.HasSuffix(line, "\r") {
+			d.lines[i] = strings.TrimSuffix(line, "\r")
+			d.ends[i] = "\r"
+		}
+
+		if i < len(d.lines)-1 {
+			d.ends[i] += "\n"
+		}
+	}
+
+	if len(d.ends) > 1 {
+		d.eol = d.ends[0]
+	}
+
+	return d
+}
+
+// Get returns key's value and whether it's present. As with LoadFile, the
+// last line assigning key wins.
+func (d *Document) Get(key string) (string, bool) {
+	i := d.find(key)
+	if i < 0 {
+		return "", false
+	}
+
+	_, v, _ := ParseLine(d.lines[i])
+
+	return v, true
+}
+
+// Set sets key to val. The line holding key's value is rewritten in place;
+// a new key is appended after the last non-blank line.
+func (d *Document) Set(key, val string) {
+	if i := d.find(key); i >= 0 {
+		d.lines[i] = key + "=" + val
+
+		return
+	}
+
+	// keep any trailing blank lines, including the empty line that follows
+	// a final newline, after the new variable.
+	end := len(d.lines)
+	for end > 0 && d.lines[end-1] == "" {
+		end--
+	}
+
+	d.lines = append(d.lines[:end], append([]string{key + "=" + val}, d.lines[end:]...)...)
+	d.ends = append(d.ends[:end], append([]string{""}, d.ends[end:]...)...)
+}
+
+// Unset removes every line assigning key, and reports whether there were
+// any. Comments around them are left alone.
+func (d *Document) Unset(key string) bool {
+	kept, keptEnds := d.lines[:0], d.ends[:0]
+	for i, line := range d.lines {
+		if k, _, ok := ParseLine(line); ok && k == key {
+			continue
+		}
+
+		kept = append(kept, line)
+		keptEnds = append(keptEnds, d.ends[i])
+	}
+
+	removed := len(kept) != len(d.lines)
+	d.lines, d.ends = kept, keptEnds
+
+	return removed
+}
+
+// Environ returns a new Environ holding the Document's variables.
+func (d *Document) Environ() *Environ {
+	return New(d.lines)
+}
+
+// WriteTo satisfies io.WriterTo, writing the Document to w. Each line
+// keeps the ending it was read with, so a file mixing "\n" and "\r\n"
+// changes only where it was edited; lines added by Set take the ending of
+// the first line break read. It returns the number of bytes written.
+func (d *Document) WriteTo(w io.Writer) (int64, error) {
+	var b strings.Builder
+	for i, line := range d.lines {
+		b.WriteString(line)
+		b.WriteString(d.end(i))
+	}
+
+	n, err := io.WriteString(w, b.String())
+
+	return int64(n), err
+}
+
+// end returns the line ending to write after line i.
+func (d *Document) end(i int) string {
+	end := d.ends[i]
+	if i == len(d.lines)-1 || strings.HasSuffix(end, "\n") {
+		return end
+	}
+
+	// a line which was last, or added by Set, now needs a line break.
+	if d.eol == "" {
+		return "\n"
+	}
+
+	return d.eol
+}
+
+// WriteFile writes the Document to path with the line endings WriteTo
+// uses, replacing the file in the same way as (*Environ).WriteFile. A value
+// set to a string containing a line break is rejected with an error naming
+// the key.
+func (d *Document) WriteFile(path string, perm os.FileMode) error {
+	for _, line := range d.lines {
+		// LoadDocument would split the line, or trim a trailing "\r".
+		if strings.Contains(line, "\n") || strings.HasSuffix(line, "\r") {
+			k, _, _ := ParseLine(line)
+
+			return fmt.Errorf("writing env file: key %q contains a line break", k)
+		}
+	}
+
+	return writeFileAtomic(path, perm, func(w io.Writer) error {
+		_, err := d.WriteTo(w)
+
+		return err
+	})
+}
+
+// find returns the index of the last line assigning key, or -1.
+func (d *Document) find(key string) int {
+	for i := len(d.lines) - 1; i >= 0; i-- {
+		if k, _, ok := ParseLine(d.lines[i]); ok && k == key {
+			return i
+		}
+	}
+
+	return -1
+}
@@ -0,0 +1,146 @@
+package environ_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/metrumresearchgroup/environ"
+)
+
+func TestDocumentRoundTrip(t *testing.T) {
+	const contents = "# database settings\nDB_HOST=localhost\nDB_PORT=5432\n\n# old value, shadowed\nTOKEN=old\nTOKEN=new\nnot a variable\n\n"
+
+	path := writeTestFile(t, contents)
+
+	doc, err := environ.LoadDocument(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if v, ok := doc.Get("TOKEN"); !ok || v != "new" {
+		t.Fatalf("unexpected TOKEN: %q, %v", v, ok)
+	}
+
+	doc.Set("DB_PORT", "6543")
+	doc.Set("TOKEN", "newer")
+	doc.Set("ADDED", "added")
+
+	if !doc.Unset("DB_HOST") {
+		t.Fatalf("expected DB_HOST to be removed")
+	}
+
+	if doc.Unset("MISSING") {
+		t.Fatalf("expected MISSING not to be removed")
+	}
+
+	if err = doc.WriteFile(path, 0o600); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	const want = "# database settings\nDB_PORT=6543\n\n# old value, shadowed\nTOKEN=old\nTOKEN=newer\nnot a variable\nADDED=added\n\n"
+	if string(data) != want {
+		t.Fatalf("expected:\n%q\ngot:\n%q", want, data)
+	}
+
+	if !reflect.DeepEqual(doc.Environ().AsSlice(), []string{"ADDED=added", "DB_PORT=6543", "TOKEN=newer"}) {
+		t.Fatalf("unexpected environ: %v", doc.Environ().AsSlice())
+	}
+}
+
+func TestDocumentUnchanged(t *testing.T) {
+	const contents = "# comment\nA=A\n\nB = spaced \nC="
+
+	doc, err := environ.ReadDocument(strings.NewReader(contents))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if _, err = doc.WriteTo(&buf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if buf.String() != contents {
+		t.Fatalf("expected %q, got %q", contents, buf.String())
+	}
+}
+
+func TestDocumentCRLF(t *testing.T) {
+	path := writeTestFile(t, "# comment\r\nA=A\r\nB=B\r\n")
+
+	doc, err := environ.LoadDocument(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if v, _ := doc.Get("A"); v != "A" {
+		t.Fatalf("unexpected A: %q", v)
+	}
+
+	doc.Set("B", "Bee")
+	doc.Set("C", "C")
+
+	if err = doc.WriteFile(path, 0o600); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	const want = "# comment\r\nA=A\r\nB=Bee\r\nC=C\r\n"
+	if string(data) != want {
+		t.Fatalf("expected:\n%q\ngot:\n%q", want, data)
+	}
+}
+
+func TestDocumentMixedLineEndings(t *testing.T) {
+	doc, err := environ.ReadDocument(strings.NewReader("A=A\r\nB=B\nC=C\r\nD=D"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	doc.Set("B", "Bee")
+	doc.Unset("C")
+	doc.Set("E", "E")
+
+	var buf bytes.Buffer
+	if _, err = doc.WriteTo(&buf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	const want = "A=A\r\nB=Bee\nD=D\r\nE=E"
+	if buf.String() != want {
+		t.Fatalf("expected %q, got %q", want, buf.String())
+	}
+}
+
+func TestDocumentWriteFileLineBreak(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".env")
+
+	doc, err := environ.ReadDocument(strings.NewReader("A=A\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	doc.Set("A", "two\nlines")
+
+	err = doc.WriteFile(path, 0o600)
+	if err == nil || !strings.Contains(err.Error(), `"A"`) {
+		t.Fatalf("expected an error naming the key, got: %v", err)
+	}
+
+	if _, err = os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("expected no file to be written, got: %v", err)
+	}
+}
@@ -0,0 +1,150 @@
+package environ_test
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/metrumresearchgroup/environ"
+)
+
+func TestNewDotenv(t *testing.T) {
+	env := environ.NewDotenv([]string{
+		"# comment",
+		`NAME="John Doe"`,
+		`SINGLE='a\nb "c"'`,
+		`DOUBLE="a\tb \"c\" \\n \x"`,
+		`UNQUOTED=a "b" c`,
+		`MISMATCHED="a'`,
+		`LONE="`,
+		`EMPTY=""`,
+	})
+
+	want := map[string]string{
+		"NAME":       "John Doe",
+		"SINGLE":     `a\nb "c"`,
+		"DOUBLE":     "a\tb \"c\" \\n \\x",
+		"UNQUOTED":   `a "b" c`,
+		"MISMATCHED": `"a'`,
+		"LONE":       `"`,
+		"EMPTY":      "",
+	}
+
+	if !reflect.DeepEqual(env.AsMap(), want) {
+		t.Fatalf("unexpected map: %#v", env.AsMap())
+	}
+}
+
+func TestNewDotenvFromReader(t *testing.T) {
+	input := strings.Join([]string{
+		"# comment",
+		`NAME="John Doe"`,
+		`KEY="-----BEGIN KEY-----`,
+		`abc\"def`,
+		``,
+		`-----END KEY-----"`,
+		`ESCAPED="ends with \"`,
+		`still going \\"`,
+		`SINGLE='a'`,
+		`QUOTE="`,
+		`"`,
+		"CRLF=\"x\"\r",
+	}, "\n")
+
+	env, err := environ.NewDotenvFromReader(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := map[string]string{
+		"NAME":    "John Doe",
+		"KEY":     "-----BEGIN KEY-----\nabc\"def\n\n-----END KEY-----",
+		"ESCAPED": "ends with \"\nstill going \\",
+		"SINGLE":  "a",
+		"QUOTE":   "\n",
+		"CRLF":    "x",
+	}
+
+	if !reflect.DeepEqual(env.AsMap(), want) {
+		t.Fatalf("unexpected map: %#v", env.AsMap())
+	}
+}
+
+func TestNewDotenvShellNoise(t *testing.T) {
+	lines := []string{
+		"#!/bin/sh",
+		"set -x",
+		"export FOO=bar",
+		"export\tTABBED='t'",
+		`export  QUOTED="a b"`,
+		"alias ll='ls -l'",
+		"export",
+		"exported=kept",
+		"EXPORT_DIR=/tmp",
+	}
+
+	want := map[string]string{
+		"FOO":        "bar",
+		"TABBED":     "t",
+		"QUOTED":     "a b",
+		"exported":   "kept",
+		"EXPORT_DIR": "/tmp",
+	}
+
+	if env := environ.NewDotenv(lines); !reflect.DeepEqual(env.AsMap(), want) {
+		t.Fatalf("unexpected map: %#v", env.AsMap())
+	}
+
+	input := strings.Join(append(lines, `export KEY="multi`, `line"`), "\n")
+	want["KEY"] = "multi\nline"
+
+	env, err := environ.NewDotenvFromReader(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !reflect.DeepEqual(env.AsMap(), want) {
+		t.Fatalf("unexpected map: %#v", env.AsMap())
+	}
+
+	_, err = environ.NewDotenvFromReader(strings.NewReader(`export KEY="open`))
+	if !errors.Is(err, environ.ErrUnterminatedQuote) || !strings.Contains(err.Error(), `"KEY"`) {
+		t.Fatalf("expected an unterminated quote error naming KEY, got: %v", err)
+	}
+}
+
+func TestNewDotenvFromReaderTrailingComment(t *testing.T) {
+	lines := []string{`A="x" # c`, `B=2`, `C="y"`, `D="a\" b" # c`}
+
+	env, err := environ.NewDotenvFromReader(strings.NewReader(strings.Join(lines, "\n")))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := map[string]string{
+		"A": `"x" # c`,
+		"B": "2",
+		"C": "y",
+		"D": `"a\" b" # c`,
+	}
+
+	if !reflect.DeepEqual(env.AsMap(), want) {
+		t.Fatalf("unexpected map: %#v", env.AsMap())
+	}
+
+	if !reflect.DeepEqual(environ.NewDotenv(lines).AsMap(), want) {
+		t.Fatalf("NewDotenv disagrees: %#v", environ.NewDotenv(lines).AsMap())
+	}
+
+	if _, err = environ.NewDotenvFromReader(strings.NewReader(`A="x" # c`)); err != nil {
+		t.Fatalf("unexpected error for a closed value: %v", err)
+	}
+}
+
+func TestNewDotenvFromReaderUnterminated(t *testing.T) {
+	_, err := environ.NewDotenvFromReader(strings.NewReader("A=A\nKEY=\"abc\ndef\n"))
+	if !errors.Is(err, environ.ErrUnterminatedQuote) || !strings.Contains(err.Error(), "KEY") {
+		t.Fatalf("expected ErrUnterminatedQuote naming KEY, got: %v", err)
+	}
+}
@@ -0,0 +1,19 @@
+package environ
+
+// Env is the core of the Environ API, for code which wants to accept an
+// Environ without depending on the concrete type, such as to take a mock
+// in tests or a wrapper like NewLogging. *Environ implements it.
+type Env interface {
+	Get(key string) string
+	Has(key string) bool
+	Keys() []string
+	AsMap() map[string]string
+	AsSlice() []string
+
+	Set(key, val string)
+	Unset(key string)
+	Keep(patterns ...string) (missing []string, err error)
+	Drop(patterns ...string) (missing []string, err error)
+}
+
+var _ Env = (*Environ)(nil)
@@ -0,0 +1,30 @@
+package environ_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/metrumresearchgroup/environ"
+)
+
+// countKept stands in for library code accepting the Env interface.
+func countKept(env environ.Env, pattern string) (int, error) {
+	if _, err := env.Keep(pattern); err != nil {
+		return 0, err
+	}
+
+	return len(env.Keys()), nil
+}
+
+func TestEnvInterface(t *testing.T) {
+	env := environ.New([]string{"A_1=1", "A_2=2", "B=B"})
+
+	n, err := countKept(env, "A_.*")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if n != 2 || !reflect.DeepEqual(env.AsSlice(), []string{"A_1=1", "A_2=2"}) {
+		t.Fatalf("unexpected result %d: %v", n, env.AsSlice())
+	}
+}
@@ -4,18 +4,67 @@
 package environ
 
 import (
+	"bufio"
+	"bytes"
 	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
 	"os"
+	"path"
+	"reflect"
 	"regexp"
 	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 )
 
 // An Environ holds a set of environment variables for manipulation.
 type Environ struct {
+	// size mirrors len(m) so Len doesn't need the lock. It's only written
+	// while holding the write lock, and is kept first for 64-bit alignment
+	// of atomic operations on 32-bit platforms.
+	size int64
+
 	l locker
 	m map[string]string
+
+	// fold makes key lookups case-insensitive, as on Windows. folded maps
+	// each key's folded form to the spelling it's stored under; entries
+	// for deleted keys may linger, so lookup checks them against m.
+	fold   bool
+	folded map[string]string
+
+	// ordered makes put and del record the order keys were added in.
+	// position maps each tracked key to its index in order; other entries
+	// of order are stale.
+	ordered  bool
+	order    []string
+	position map[string]int
+
+	observers []func(ChangeEvent)
+	secrets   []*regexp.Regexp
+
+	// pending holds the events of batch writes, and before the contents a
+	// whole-set write started from. Both are guarded by the lock, and the
+	// unlocker returned by writeLocker sends them once it's released.
+	pending []ChangeEvent
+	before  map[string]string
+
+	// parent is set for a Child, and never changes; hidden and detached
+	// are guarded by the lock.
+	parent   *Environ
+	hidden   map[string]bool
+	detached bool
+
+	// frozen is set by Freeze, and never changes.
+	frozen bool
+
+	// lazy is set by FromOSLazy, and never changes. osCache has a lock of
+	// its own, as reads fill it.
+	lazy    bool
+	osCache *osCache
 }
 
 // FromOS returns an Environ containing the current os.Environ().
@@ -23,187 +72,1698 @@ func FromOS() *Environ {
 	return New(os.Environ())
 }
 
-// Len returns the length of the underling environment map.
-func (e *Environ) Len() int {
-	defer e.readLocker()()
+// MergeOS fills in any variables from the current os.Environ() that the
+// Environ doesn't already hold. Existing keys keep their values.
+func (e *Environ) MergeOS() {
+	e.MergeFunc(FromOS(), func(_, existing, _ string) string {
+		return existing
+	})
+}
+
+// OverrideWithOS overlays the current os.Environ() onto the Environ,
+// clobbering any keys the process environment also holds.
+func (e *Environ) OverrideWithOS() {
+	e.Merge(FromOS())
+}
+
+// ApplyToOS sets every variable in the Environ on the current process
+// with os.Setenv. Variables already in the process environment but absent
+// from the Environ are left alone.
+//
+// It returns the first error from os.Setenv, in which case the variables
+// set before the failure remain applied.
+func (e *Environ) ApplyToOS() error {
+	defer e.readLocker()()
+
+	return applyToOS(e.view())
+}
+
+// ApplyToOSExclusive clears the process environment with os.Clearenv and
+// then applies the Environ, so that os.Environ() matches it exactly.
+//
+// It returns the first error from os.Setenv, in which case the process
+// environment is left partially applied.
+func (e *Environ) ApplyToOSExclusive() error {
+	defer e.readLocker()()
+
+	os.Clearenv()
+
+	return applyToOS(e.view())
+}
+
+// WithEnv runs fn with the process environment replaced by e, as by
+// ApplyToOSExclusive, and restores the original environment afterwards,
+// even if fn panics. It's meant for tests of code which reads os.Getenv.
+//
+// The process environment is global, so fn mustn't run alongside anything
+// else which uses it, such as parallel tests or other WithEnv calls.
+//
+// If e can't be applied, WithEnv restores the environment and returns the
+// error without calling fn.
+func WithEnv(e *Environ, fn func()) (err error) {
+	orig := envSliceAsMap(os.Environ())
+
+	defer func() {
+		os.Clearenv()
+
+		if restoreErr := applyToOS(orig); err == nil {
+			err = restoreErr
+		}
+	}()
+
+	if err = e.ApplyToOSExclusive(); err != nil {
+		return err
+	}
+
+	fn()
+
+	return nil
+}
+
+func applyToOS(m map[string]string) error {
+	for _, k := range keys(m) {
+		if err := os.Setenv(k, m[k]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Len returns the length of the underling environment map. Except for a
+// Child or an Environ from FromOSLazy, it doesn't take the lock, so it's
+// cheap to poll.
+func (e *Environ) Len() int {
+	if e.parent != nil || e.lazy {
+		defer e.readLocker()()
+
+		return len(e.view())
+	}
+
+	return int(atomic.LoadInt64(&e.size))
+}
+
+// SizeBytes returns the total length of the Environ's "key=value" strings,
+// as a rough measure of its memory footprint.
+func (e *Environ) SizeBytes() int {
+	defer e.readLocker()()
+
+	var n int
+	for k, v := range e.view() {
+		n += len(k) + len("=") + len(v)
+	}
+
+	return n
+}
+
+// MarshalJSON satisfies json.Marshaler interface.
+func (e *Environ) MarshalJSON() ([]byte, error) {
+	// AsSlice takes the read lock itself; taking it here as well could
+	// deadlock against a waiting writer.
+	return json.Marshal(e.AsSlice())
+}
+
+// MarshalJSONObject marshals the Environ as a JSON object mapping keys to
+// values, in lexical key order, for consumers that expect a map rather than
+// the array produced by MarshalJSON. UnmarshalJSON accepts either form.
+func (e *Environ) MarshalJSONObject() ([]byte, error) {
+	return json.Marshal(e.AsMap())
+}
+
+// EncodeJSON writes the Environ to w as the same JSON array MarshalJSON
+// produces, followed by a newline as json.Encoder does. Entries are encoded
+// one at a time rather than building the whole slice and its encoding in
+// memory first.
+func (e *Environ) EncodeJSON(w io.Writer) error {
+	defer e.readLocker()()
+
+	m := e.view()
+
+	var entry bytes.Buffer
+	enc := json.NewEncoder(&entry)
+
+	bw := bufio.NewWriter(w)
+	_ = bw.WriteByte('[')
+
+	for i, k := range keys(m) {
+		if i > 0 {
+			_ = bw.WriteByte(',')
+		}
+
+		entry.Reset()
+		if err := enc.Encode(k + "=" + m[k]); err != nil {
+			return err
+		}
+
+		// Encode terminates each value with a newline, which only belongs
+		// after the closing bracket.
+		_, _ = bw.Write(bytes.TrimSuffix(entry.Bytes(), []byte{'\n'}))
+	}
+
+	_, _ = bw.WriteString("]\n")
+
+	return bw.Flush()
+}
+
+// UnmarshalJSON satisfies json.Unmarshaler interface. It accepts either an
+// array of "key=value" strings, as produced by MarshalJSON, or an object
+// mapping keys to string values.
+//
+// The contents are replaced under the write lock, so it's safe to call
+// while other goroutines use the Environ. Settings such as case
+// insensitivity and registered secrets are kept.
+func (e *Environ) UnmarshalJSON(data []byte) error {
+	m, err := unmarshalJSONMap(data)
+	if err != nil {
+		return err
+	}
+
+	e.replace(m)
+
+	return nil
+}
+
+// replace swaps in m as the contents of the Environ, under its existing
+// lock. A zero Environ, such as one allocated by json.Unmarshal, isn't yet
+// shared, so it's initialized directly.
+func (e *Environ) replace(m map[string]string) {
+	if e.l == nil {
+		*e = *newEnviron(m)
+
+		return
+	}
+
+	defer e.writeLocker()()
+
+	e.snapshot()
+	e.m = m
+	e.order = nil
+	e.position = nil
+	e.reindex()
+
+	// the new contents replace the merged view, so a Child stops reading
+	// through to its parent, as after materialize.
+	if e.layered() {
+		e.detached = true
+		e.hidden = nil
+	}
+}
+
+// MergeJSON parses data as UnmarshalJSON does, accepting either form, and
+// overlays the values onto the Environ, clobbering any existing keys but
+// keeping the rest. If data doesn't parse, the Environ is unchanged.
+//
+// Keys from the array form are set in the order they're listed, and those
+// from the object form in lexical order, as by SetAllSlice and SetAll.
+func (e *Environ) MergeJSON(data []byte) error {
+	if isJSONArray(data) {
+		var environ []string
+		if err := json.Unmarshal(data, &environ); err != nil {
+			return err
+		}
+
+		e.SetAllSlice(environ)
+
+		return nil
+	}
+
+	m, err := unmarshalJSONMap(data)
+	if err != nil {
+		return err
+	}
+
+	e.SetAll(m)
+
+	return nil
+}
+
+// isJSONArray reports whether data holds the array form of an Environ
+// rather than the object form.
+func isJSONArray(data []byte) bool {
+	trimmed := bytes.TrimLeft(data, " \t\r\n")
+
+	return len(trimmed) == 0 || trimmed[0] != '{'
+}
+
+func unmarshalJSONMap(data []byte) (map[string]string, error) {
+	if isJSONArray(data) {
+		var environ []string
+		if err := json.Unmarshal(data, &environ); err != nil {
+			return nil, err
+		}
+
+		return envSliceAsMap(environ), nil
+	}
+
+	var object map[string]interface{}
+	if err := json.Unmarshal(data, &object); err != nil {
+		return nil, err
+	}
+
+	m := make(map[string]string, len(object))
+	for _, k := range keysOf(object) {
+		v, ok := object[k].(string)
+		if !ok {
+			return nil, fmt.Errorf("value of %q is %T, not a string", k, object[k])
+		}
+
+		m[k] = v
+	}
+
+	return m, nil
+}
+
+// New creates an Environ from a list of "key=value" strings.
+func New(environ []string) *Environ {
+	return newEnviron(envSliceAsMap(environ))
+}
+
+// NewChecked behaves like New, but also returns the sorted keys which
+// appear more than once in environ. As with New, the last value wins.
+func NewChecked(environ []string) (*Environ, []string) {
+	m := make(map[string]string, len(environ))
+	duplicates := make([]string, 0)
+
+	counts := make(map[string]int, len(environ))
+	for _, line := range environ {
+		k, v, ok := ParseLine(line)
+		if !ok {
+			continue
+		}
+
+		if counts[k]++; counts[k] == 2 {
+			duplicates = append(duplicates, k)
+		}
+
+		m[k] = v
+	}
+
+	sort.Strings(duplicates)
+
+	return newEnviron(m), duplicates
+}
+
+// NewWithCapacity creates an Environ from a list of "key=value" strings,
+// sized to hold extraCap more variables without growing. A negative extraCap
+// is treated as zero.
+func NewWithCapacity(environ []string, extraCap int) *Environ {
+	if extraCap < 0 {
+		extraCap = 0
+	}
+
+	m := make(map[string]string, len(environ)+extraCap)
+	for _, line := range environ {
+		if k, v, ok := ParseLine(line); ok {
+			m[k] = v
+		}
+	}
+
+	return newEnviron(m)
+}
+
+// NewFromMap creates an Environ holding a copy of m. Later changes to m
+// don't affect the Environ.
+func NewFromMap(m map[string]string) *Environ {
+	return newEnviron(copyMap(m))
+}
+
+func newEnviron(m map[string]string) *Environ {
+	return &Environ{
+		size: int64(len(m)),
+		l:    new(sync.RWMutex),
+		m:    m,
+	}
+}
+
+// NewCaseInsensitive creates an Environ from a list of "key=value" strings
+// whose keys are matched case-insensitively by Get, GetOK, Has, Set and
+// Unset, as environment variables are on Windows. Getting "path" returns
+// the value stored under "PATH".
+//
+// Keys keep the casing they were first stored with, which is what AsSlice,
+// AsMap and Keys report. When the list holds several spellings of one key,
+// the last value wins under the first spelling.
+//
+// Every method taking keys matches them the same way, including Merge,
+// MergeFunc, MergeFile, KeepLiteral and DropLiteral, so merging "path=y"
+// into an Environ holding "PATH" replaces its value. Keep, Drop and the
+// other pattern-based methods still match the stored spelling.
+//
+// Methods which replace the contents as a whole, such as UnmarshalJSON,
+// NormalizeKeys and Transform, collapse spellings of one key in the same
+// way, taking the keys in lexical order.
+func NewCaseInsensitive(environ []string) *Environ {
+	e := newEnviron(make(map[string]string, len(environ)))
+	e.fold = true
+	e.folded = make(map[string]string, len(environ))
+	e.putLines(environ)
+
+	e.size = int64(len(e.m))
+
+	return e
+}
+
+// lookup returns the key under which key is stored in the map, which
+// differs from key only in case-insensitive mode. A Child that doesn't hold
+// key takes the spelling its parent stores it under. If key isn't present,
+// it's returned unchanged. The caller must hold a lock.
+func (e *Environ) lookup(key string) string {
+	if !e.fold {
+		return key
+	}
+
+	if _, ok := e.m[key]; ok {
+		return key
+	}
+
+	if k, ok := e.folded[foldKey(key)]; ok {
+		if _, ok := e.m[k]; ok {
+			return k
+		}
+	}
+
+	if e.layered() && e.parent != nil {
+		return e.parent.resolve(key)
+	}
+
+	return key
+}
+
+// resolve behaves like lookup, taking the read lock itself.
+func (e *Environ) resolve(key string) string {
+	defer e.readLocker()()
+
+	return e.lookup(key)
+}
+
+// foldKey returns the form of key shared by every spelling of it that
+// differs only in case.
+func foldKey(key string) string {
+	return strings.ToLower(strings.ToUpper(key))
+}
+
+// reindex rebuilds folded from the keys in m, after m has been replaced
+// as a whole. In case-insensitive mode, keys which differ only in case are
+// collapsed into one, as by NewCaseInsensitive: taken in lexical order, the
+// last value wins under the first spelling. The caller must hold the write
+// lock, or be the only user of the Environ.
+func (e *Environ) reindex() {
+	if !e.fold {
+		e.folded = nil
+
+		return
+	}
+
+	e.folded = make(map[string]string, len(e.m))
+
+	for _, k := range keys(e.m) {
+		stored, ok := e.folded[foldKey(k)]
+		if !ok {
+			e.folded[foldKey(k)] = k
+
+			continue
+		}
+
+		e.m[stored] = e.m[k]
+		delete(e.m, k)
+	}
+}
+
+// Clone returns a deep copy of the Environ, with its own lock and map, so
+// that changes to either one do not affect the other.
+func (e *Environ) Clone() *Environ {
+	defer e.readLocker()()
+
+	m := e.view()
+
+	c := e.derive(copyMap(m))
+	c.secrets = append([]*regexp.Regexp(nil), e.secrets...)
+
+	if e.ordered {
+		c.ordered = true
+		c.setOrder(e.orderedKeys(m))
+	}
+
+	return c
+}
+
+// derive returns a new Environ holding m, with the same settings as e.
+func (e *Environ) derive(m map[string]string) *Environ {
+	d := newEnviron(m)
+	d.fold = e.fold
+	d.reindex()
+
+	return d
+}
+
+// Set updates the Environ, replacing the value at key with val. If
+// such already exists, it'll be clobbered.
+//
+// Set accepts any key, but one containing "=" won't survive a round trip
+// through AsSlice and New; use TrySet or SetStrict to reject such keys.
+func (e *Environ) Set(key, val string) {
+	e.notify(e.set(key, val))
+}
+
+func (e *Environ) set(key, val string) (event *ChangeEvent, observers []func(ChangeEvent)) {
+	defer e.writeLocker()()
+
+	return e.change(e.lookup(key), val), e.observers
+}
+
+// change stores val under key, which must be the spelling lookup returns,
+// and describes the change, or returns nil if key already held val. The
+// caller must hold the write lock.
+func (e *Environ) change(key, val string) *ChangeEvent {
+	old, existed := e.get(key)
+	e.put(key, val)
+
+	if existed && old == val {
+		return nil
+	}
+
+	return &ChangeEvent{Op: OpSet, Key: key, Old: old, New: val}
+}
+
+// SetAll sets every key in pairs to its value under a single lock, so
+// other goroutines never observe a partially applied update. Existing
+// values are clobbered. Keys are set in lexical order, which is the order
+// a NewOrdered Environ records new keys in.
+func (e *Environ) SetAll(pairs map[string]string) {
+	defer e.writeLocker()()
+
+	for _, k := range keys(pairs) {
+		e.record(e.change(e.lookup(k), pairs[k]))
+	}
+}
+
+// SetAllSlice behaves like SetAll, taking "key=value" strings parsed with
+// the same rules as New. Keys are set in the order they're listed, and
+// when a key is listed more than once, its last value wins.
+func (e *Environ) SetAllSlice(pairs []string) {
+	defer e.writeLocker()()
+
+	e.putLines(pairs)
+}
+
+// putLines stores each "key=value" line in turn. The caller must hold the
+// write lock.
+func (e *Environ) putLines(lines []string) {
+	for _, line := range lines {
+		if k, v, ok := ParseLine(line); ok {
+			e.record(e.change(e.lookup(k), v))
+		}
+	}
+}
+
+// SetIfAbsent sets key to val only if key isn't already present, and
+// reports whether it did. A key holding the empty string is present, and
+// isn't overwritten.
+func (e *Environ) SetIfAbsent(key, val string) bool {
+	event, observers := e.setIfAbsent(key, val)
+	e.notify(event, observers)
+
+	return event != nil
+}
+
+func (e *Environ) setIfAbsent(key, val string) (event *ChangeEvent, observers []func(ChangeEvent)) {
+	defer e.writeLocker()()
+
+	key = e.lookup(key)
+	if _, ok := e.get(key); ok {
+		return nil, nil
+	}
+
+	e.put(key, val)
+
+	return &ChangeEvent{Op: OpSet, Key: key, New: val}, e.observers
+}
+
+// Merge copies every key from other into the Environ, clobbering any
+// existing values.
+func (e *Environ) Merge(other *Environ) {
+	e.MergeFunc(other, func(_, _, incoming string) string {
+		return incoming
+	})
+}
+
+// MergeSlice overlays "key=value" strings, parsed with the same rules as
+// New, onto the Environ under a single lock, clobbering any existing keys.
+// It's the same as SetAllSlice, named to sit alongside Merge.
+func (e *Environ) MergeSlice(environ []string) {
+	e.SetAllSlice(environ)
+}
+
+// MergeFunc copies every key from other into the Environ. When a key exists
+// in both, resolve is called with the key, the existing value and the
+// incoming value, and its result is stored.
+//
+// other is copied under its read lock before the Environ's write lock is
+// taken, so it's safe to merge an Environ with itself, or to merge two
+// Environs into each other concurrently. resolve must not call methods on
+// the Environ, as it runs under the write lock.
+//
+// Keys are merged in lexical order, as by SetAll.
+func (e *Environ) MergeFunc(other *Environ, resolve func(key, existing, incoming string) string) {
+	incoming := other.AsMap()
+
+	defer e.writeLocker()()
+
+	for _, k := range keys(incoming) {
+		v := incoming[k]
+
+		k = e.lookup(k)
+		if existing, ok := e.get(k); ok {
+			v = resolve(k, existing, v)
+		}
+
+		e.record(e.change(k, v))
+	}
+}
+
+// Unset deletes key's value from the Environ.
+func (e *Environ) Unset(key string) {
+	e.notify(e.unset(key))
+}
+
+func (e *Environ) unset(key string) (event *ChangeEvent, observers []func(ChangeEvent)) {
+	defer e.writeLocker()()
+
+	return e.remove(e.lookup(key)), e.observers
+}
+
+// remove deletes key, which must be the spelling lookup returns, and
+// describes the change, or returns nil if key was missing. The caller must
+// hold the write lock.
+func (e *Environ) remove(key string) *ChangeEvent {
+	old, existed := e.get(key)
+	if !existed {
+		return nil
+	}
+
+	e.del(key)
+
+	return &ChangeEvent{Op: OpUnset, Key: key, Old: old}
+}
+
+// UnsetAll deletes every one of keys from the Environ under a single lock,
+// so other goroutines never observe a partially applied update. It returns
+// the number of keys which were present.
+func (e *Environ) UnsetAll(keys ...string) int {
+	defer e.writeLocker()()
+
+	var n int
+	for _, k := range keys {
+		if event := e.remove(e.lookup(k)); event != nil {
+			e.record(event)
+			n++
+		}
+	}
+
+	return n
+}
+
+// Rename moves the value stored under oldKey to newKey, and reports
+// whether oldKey was present. If it wasn't, the Environ is unchanged. If
+// newKey already exists, its value is clobbered.
+func (e *Environ) Rename(oldKey, newKey string) bool {
+	unset, set, observers, ok := e.rename(oldKey, newKey)
+	e.notify(unset, observers)
+	e.notify(set, observers)
+
+	return ok
+}
+
+// rename returns the events for the removal of oldKey and the setting of
+// newKey, which are nil when renaming a key to itself.
+func (e *Environ) rename(oldKey, newKey string) (unset, set *ChangeEvent, observers []func(ChangeEvent), ok bool) {
+	defer e.writeLocker()()
+
+	oldKey = e.lookup(oldKey)
+	v, ok := e.get(oldKey)
+	if !ok {
+		return nil, nil, nil, false
+	}
+
+	// renaming a key to itself mustn't move it to the end of the order.
+	if newKey == oldKey {
+		return nil, nil, nil, true
+	}
+
+	e.del(oldKey)
+
+	newKey = e.lookup(newKey)
+	old, _ := e.get(newKey)
+	e.put(newKey, v)
+
+	unset = &ChangeEvent{Op: OpUnset, Key: oldKey, Old: v}
+	set = &ChangeEvent{Op: OpSet, Key: newKey, Old: old, New: v}
+
+	return unset, set, e.observers, true
+}
+
+// Clear removes every variable from the Environ, leaving it empty but
+// usable.
+func (e *Environ) Clear() {
+	defer e.writeLocker()()
+
+	e.rewrite()
+	e.m = make(map[string]string)
+	e.reindex()
+}
+
+// Get retrieves the value in the Environ under key, or "" if missing.
+func (e *Environ) Get(key string) string {
+	defer e.readLocker()()
+
+	v, _ := e.get(e.lookup(key))
+
+	return v
+}
+
+// GetOK retrieves the value in the Environ under key, and whether the key
+// was present, so that an empty value can be told apart from a missing one.
+func (e *Environ) GetOK(key string) (string, bool) {
+	defer e.readLocker()()
+
+	return e.get(e.lookup(key))
+}
+
+// GetDefault retrieves the value in the Environ under key, or fallback if
+// the key is missing. A key holding the empty string is present, so its
+// empty value is returned rather than fallback.
+func (e *Environ) GetDefault(key, fallback string) string {
+	if v, ok := e.GetOK(key); ok {
+		return v
+	}
+
+	return fallback
+}
+
+// Has reports whether key is present in the Environ, regardless of its
+// value.
+func (e *Environ) Has(key string) bool {
+	defer e.readLocker()()
+
+	_, ok := e.get(e.lookup(key))
+
+	return ok
+}
+
+// Equal reports whether the Environ and other hold exactly the same keys
+// and values.
+func (e *Environ) Equal(other *Environ) bool {
+	if e == other {
+		return true
+	}
+
+	m, om, unlock := readViews(e, other)
+	defer unlock()
+
+	if len(m) != len(om) {
+		return false
+	}
+
+	for k, v := range m {
+		if ov, ok := om[k]; !ok || ov != v {
+			return false
+		}
+	}
+
+	return true
+}
+
+// EqualIgnoring behaves like Equal, but leaves the keys in ignore out of the
+// comparison on both sides, such as volatile variables like PWD or SHLVL.
+// Keys are compared by string equality.
+func (e *Environ) EqualIgnoring(other *Environ, ignore ...string) bool {
+	if e == other {
+		return true
+	}
+
+	m, om, unlock := readViews(e, other)
+	defer unlock()
+
+	skip := make(map[string]bool, len(ignore))
+	for _, k := range ignore {
+		skip[k] = true
+	}
+
+	for k, v := range m {
+		if skip[k] {
+			continue
+		}
+
+		if ov, ok := om[k]; !ok || ov != v {
+			return false
+		}
+	}
+
+	for k := range om {
+		if _, ok := m[k]; !ok && !skip[k] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Diff compares the Environ against a baseline, other. It returns the
+// sorted keys only present in the Environ as added, those only present in
+// other as removed, and those present in both with different values as
+// changed.
+func (e *Environ) Diff(other *Environ) (added, removed, changed []string) {
+	added = make([]string, 0)
+	removed = make([]string, 0)
+	changed = make([]string, 0)
+
+	if e == other {
+		return added, removed, changed
+	}
+
+	m, om, unlock := readViews(e, other)
+	defer unlock()
+
+	for k, v := range m {
+		ov, ok := om[k]
+		switch {
+		case !ok:
+			added = append(added, k)
+		case ov != v:
+			changed = append(changed, k)
+		}
+	}
+
+	for k := range om {
+		if _, ok := m[k]; !ok {
+			removed = append(removed, k)
+		}
+	}
+
+	sort.Strings(added)
+	sort.Strings(removed)
+	sort.Strings(changed)
+
+	return added, removed, changed
+}
+
+// DeltaTo returns the changes which turn the Environ into target: set holds
+// the keys to add or change with their values in target, and unset the
+// sorted keys to remove. Applying them, such as with os.Setenv and
+// os.Unsetenv, leaves a set of variables equal to target.
+func (e *Environ) DeltaTo(target *Environ) (set map[string]string, unset []string) {
+	set = make(map[string]string)
+	unset = make([]string, 0)
+
+	if e == target {
+		return set, unset
+	}
+
+	m, tm, unlock := readViews(e, target)
+	defer unlock()
+
+	for k, v := range tm {
+		if old, ok := m[k]; !ok || old != v {
+			set[k] = v
+		}
+	}
+
+	for k := range m {
+		if _, ok := tm[k]; !ok {
+			unset = append(unset, k)
+		}
+	}
+
+	sort.Strings(unset)
+
+	return set, unset
+}
+
+// Intersect returns a new Environ holding only the variables present in
+// both the Environ and other with equal values.
+func (e *Environ) Intersect(other *Environ) *Environ {
+	if e == other {
+		return e.Clone()
+	}
+
+	m, om, unlock := readViews(e, other)
+	defer unlock()
+
+	common := make(map[string]string)
+	for k, v := range m {
+		if ov, ok := om[k]; ok && ov == v {
+			common[k] = v
+		}
+	}
+
+	return e.derive(common)
+}
+
+// Keep scans the Environ looking for matching patterns and
+// keeps them while dropping all others.
+//
+// It returns the slice of patterns it could not find.
+//
+// All patterns are treated as a regular expression, which will error on
+// compile failures.
+func (e *Environ) Keep(patterns ...string) (missing []string, err error) {
+	_, missing, err = e.KeepReport(patterns...)
+
+	return missing, err
+}
+
+// KeepReport behaves like Keep, but additionally returns the sorted slice
+// of keys that were kept.
+func (e *Environ) KeepReport(patterns ...string) (kept []string, missing []string, err error) {
+	// compile before locking, so that the match and mutation that follow
+	// happen atomically with respect to other writers.
+	regexps, missing, err := compilePatterns(patterns)
+	if err != nil {
+		return nil, missing, err
+	}
+
+	defer e.writeLocker()()
+
+	e.rewrite()
+	kept, missing = keep(&e.m, patterns, regexps)
+
+	return kept, missing, nil
+}
+
+func keep(m *map[string]string, patterns []string, regexps map[string]*regexp.Regexp) (kept []string, missing []string) {
+	matched, missing := matchCompiled(*m, patterns, regexps)
+
+	keeping := make(map[string]string, len(*m))
+	for _, keepKey := range matched {
+		keeping[keepKey] = (*m)[keepKey]
+	}
+
+	*m = keeping
+
+	return matched, missing
+}
+
+// Drop scans the Environ looking for matching patterns and
+// drops them while keeping all others.
+//
+// It returns the slice of patterns it could not find.
+//
+// All patterns are treated as a regular expression, which will error on
+// compile failures.
+func (e *Environ) Drop(patterns ...string) (missing []string, err error) {
+	_, missing, err = e.DropReport(patterns...)
+
+	return missing, err
+}
+
+// DropReport behaves like Drop, but additionally returns the sorted slice
+// of keys that were dropped.
+func (e *Environ) DropReport(patterns ...string) (dropped []string, missing []string, err error) {
+	regexps, missing, err := compilePatterns(patterns)
+	if err != nil {
+		return nil, missing, err
+	}
+
+	defer e.writeLocker()()
+
+	e.rewrite()
+	dropped, missing = drop(e.m, patterns, regexps)
+
+	return dropped, missing, nil
+}
+
+func drop(m map[string]string, patterns []string, regexps map[string]*regexp.Regexp) (dropped []string, missing []string) {
+	matched, missing := matchCompiled(m, patterns, regexps)
+
+	for _, dropKey := range matched {
+		delete(m, dropKey)
+	}
+
+	return matched, missing
+}
+
+// KeepContains behaves like Keep, but the patterns aren't anchored, so a
+// pattern matches any key containing a match: "AWS" keeps AWS_REGION as
+// well as AWS, as grep would.
+func (e *Environ) KeepContains(patterns ...string) (missing []string, err error) {
+	regexps, missing, err := compileUnanchored(patterns)
+	if err != nil {
+		return missing, err
+	}
+
+	defer e.writeLocker()()
+
+	e.rewrite()
+	_, missing = keep(&e.m, patterns, regexps)
+
+	return missing, nil
+}
+
+// DropContains behaves like Drop, but the patterns aren't anchored, so a
+// pattern matches any key containing a match: "AWS" drops AWS_REGION as
+// well as AWS, as grep would.
+func (e *Environ) DropContains(patterns ...string) (missing []string, err error) {
+	regexps, missing, err := compileUnanchored(patterns)
+	if err != nil {
+		return missing, err
+	}
+
+	defer e.writeLocker()()
+
+	e.rewrite()
+	_, missing = drop(e.m, patterns, regexps)
+
+	return missing, nil
+}
+
+// compileUnanchored behaves like compilePatterns, without anchoring the
+// patterns.
+func compileUnanchored(patterns []string) (regexps map[string]*regexp.Regexp, missing []string, err error) {
+	regexps = make(map[string]*regexp.Regexp, len(patterns))
+	for _, pattern := range patterns {
+		var regex *regexp.Regexp
+
+		regex, err = regexp.Compile(pattern)
+		if err != nil {
+			return nil, []string{pattern}, err
+		}
+
+		regexps[pattern] = regex
+	}
+
+	return regexps, nil, nil
+}
+
+// KeepDryRun previews Keep or Drop without modifying the Environ. It
+// returns, for each pattern, the sorted keys it matches, along with the
+// missing patterns and any compile error, as Keep would.
+func (e *Environ) KeepDryRun(patterns ...string) (perPattern map[string][]string, missing []string, err error) {
+	regexps, missing, err := compilePatterns(patterns)
+	if err != nil {
+		return nil, missing, err
+	}
+
+	defer e.readLocker()()
+
+	sorted := keys(e.view())
+
+	perPattern = make(map[string][]string, len(patterns))
+	missing = make([]string, 0)
+	for _, pattern := range patterns {
+		if _, ok := perPattern[pattern]; ok {
+			continue
+		}
+
+		matched := make([]string, 0)
+		for _, k := range sorted {
+			if regexps[pattern].MatchString(k) {
+				matched = append(matched, k)
+			}
+		}
+
+		perPattern[pattern] = matched
+		if len(matched) == 0 {
+			missing = append(missing, pattern)
+		}
+	}
+
+	sort.Strings(missing)
+
+	return perPattern, missing, nil
+}
+
+// KeepBestEffort behaves like Keep, but a pattern which fails to compile
+// doesn't stop the others from being applied. Such patterns are returned in
+// invalid rather than missing, and err is the first of their compile
+// errors.
+//
+// If no pattern compiles, there's nothing to apply, so the Environ is left
+// unchanged rather than emptied as by Keep with no patterns.
+func (e *Environ) KeepBestEffort(patterns ...string) (missing []string, invalid []string, err error) {
+	valid, regexps, invalid, err := compileValid(patterns)
+	if len(valid) == 0 && len(invalid) > 0 {
+		return make([]string, 0), invalid, err
+	}
+
+	defer e.writeLocker()()
+
+	e.rewrite()
+	_, missing = keep(&e.m, valid, regexps)
+
+	return missing, invalid, err
+}
+
+// DropBestEffort behaves like Drop, but a pattern which fails to compile
+// doesn't stop the others from being applied. Such patterns are returned in
+// invalid rather than missing, and err is the first of their compile
+// errors.
+func (e *Environ) DropBestEffort(patterns ...string) (missing []string, invalid []string, err error) {
+	valid, regexps, invalid, err := compileValid(patterns)
+
+	defer e.writeLocker()()
+
+	e.rewrite()
+	_, missing = drop(e.m, valid, regexps)
+
+	return missing, invalid, err
+}
+
+// compileValid compiles each of patterns with compileAnchored, returning
+// those which compiled and the sorted slice of those which didn't, with the
+// first compile error.
+func compileValid(patterns []string) (valid []string, regexps map[string]*regexp.Regexp, invalid []string, err error) {
+	valid = make([]string, 0, len(patterns))
+	regexps = make(map[string]*regexp.Regexp, len(patterns))
+	invalid = make([]string, 0)
+
+	for _, pattern := range patterns {
+		regex, compileErr := compileAnchored(pattern)
+		if compileErr != nil {
+			invalid = append(invalid, pattern)
+			if err == nil {
+				err = compileErr
+			}
+
+			continue
+		}
+
+		valid = append(valid, pattern)
+		regexps[pattern] = regex
+	}
+
+	sort.Strings(invalid)
+
+	return valid, regexps, invalid, err
+}
+
+// KeepRegexp behaves like Keep, but takes compiled regular expressions,
+// which are used as given: they aren't anchored, so a whole-key match
+// needs "^" and "$". It returns, by their String, the expressions that
+// matched nothing.
+func (e *Environ) KeepRegexp(regexps ...*regexp.Regexp) (missing []string) {
+	patterns, compiled := regexpSet(regexps)
+
+	defer e.writeLocker()()
+
+	e.rewrite()
+	_, missing = keep(&e.m, patterns, compiled)
+
+	return missing
+}
+
+// DropRegexp behaves like Drop, but takes compiled regular expressions,
+// which are used as given: they aren't anchored, so a whole-key match
+// needs "^" and "$". It returns, by their String, the expressions that
+// matched nothing.
+func (e *Environ) DropRegexp(regexps ...*regexp.Regexp) (missing []string) {
+	patterns, compiled := regexpSet(regexps)
+
+	defer e.writeLocker()()
+
+	e.rewrite()
+	_, missing = drop(e.m, patterns, compiled)
+
+	return missing
+}
+
+func regexpSet(regexps []*regexp.Regexp) (patterns []string, compiled map[string]*regexp.Regexp) {
+	patterns = make([]string, 0, len(regexps))
+	compiled = make(map[string]*regexp.Regexp, len(regexps))
+	for _, regex := range regexps {
+		patterns = append(patterns, regex.String())
+		compiled[regex.String()] = regex
+	}
+
+	return patterns, compiled
+}
+
+// Subset returns a new Environ holding only the variables matching
+// patterns, leaving the Environ unchanged. It returns the patterns it could
+// not find, and an error if a pattern fails to compile, as Keep does.
+func (e *Environ) Subset(patterns ...string) (*Environ, []string, error) {
+	defer e.readLocker()()
+
+	m := e.view()
+	matched, missing, err := matchingKeys(m, patterns)
+	if err != nil {
+		return nil, missing, err
+	}
+
+	sub := make(map[string]string, len(matched))
+	for _, k := range matched {
+		sub[k] = m[k]
+	}
+
+	return e.derive(sub), missing, nil
+}
+
+// WithPrefix returns a new Environ holding only the variables whose keys
+// start with prefix.
+func (e *Environ) WithPrefix(prefix string) *Environ {
+	defer e.readLocker()()
+
+	m := make(map[string]string)
+	for k, v := range e.view() {
+		if strings.HasPrefix(k, prefix) {
+			m[k] = v
+		}
+	}
+
+	return e.derive(m)
+}
+
+// StripPrefix returns a new Environ holding the variables whose keys start
+// with prefix, with the prefix removed from each key, so "APP_PORT" becomes
+// "PORT" for the prefix "APP_". Keys without the prefix, and a key equal to
+// the prefix, are left out.
+func (e *Environ) StripPrefix(prefix string) *Environ {
+	defer e.readLocker()()
+
+	m := make(map[string]string)
+	for k, v := range e.view() {
+		if stripped := strings.TrimPrefix(k, prefix); stripped != k && stripped != "" {
+			m[stripped] = v
+		}
+	}
+
+	return e.derive(m)
+}
+
+// KeepLiteral keeps the variables named by keys while dropping all
+// others. Keys are compared by string equality, so no escaping is needed.
+//
+// It returns the sorted slice of keys it could not find.
+func (e *Environ) KeepLiteral(keys ...string) (missing []string) {
+	defer e.writeLocker()()
+
+	e.rewrite()
+
+	keeping := make(map[string]string, len(keys))
+	missing = make([]string, 0, len(keys))
+	for _, k := range unique(keys) {
+		stored := e.lookup(k)
+		if v, ok := e.m[stored]; ok {
+			keeping[stored] = v
+
+			continue
+		}
+
+		missing = append(missing, k)
+	}
+
+	e.m = keeping
+
+	sort.Strings(missing)
+
+	return missing
+}
+
+// KeepKeys behaves like KeepLiteral, taking the keys as a slice, such as
+// one computed elsewhere.
+func (e *Environ) KeepKeys(keys []string) (missing []string) {
+	return e.KeepLiteral(keys...)
+}
+
+// DropKeys behaves like DropLiteral, taking the keys as a slice, such as
+// one computed elsewhere.
+func (e *Environ) DropKeys(keys []string) (missing []string) {
+	return e.DropLiteral(keys...)
+}
+
+// DropExcept drops every variable not named by keys. It's the same as
+// KeepLiteral, for callers who think of the operation as a drop.
+//
+// It returns the sorted slice of keys it could not find.
+func (e *Environ) DropExcept(keys ...string) (missing []string) {
+	return e.KeepLiteral(keys...)
+}
+
+// DropLiteral drops the variables named by keys while keeping all others.
+// Keys are compared by string equality, so no escaping is needed.
+//
+// It returns the sorted slice of keys it could not find.
+func (e *Environ) DropLiteral(keys ...string) (missing []string) {
+	defer e.writeLocker()()
+
+	e.rewrite()
+
+	// resolve every key before deleting any, so that two spellings of one
+	// key in case-insensitive mode both find it.
+	dropping := make([]string, 0, len(keys))
+	missing = make([]string, 0, len(keys))
+	for _, k := range unique(keys) {
+		stored := e.lookup(k)
+		if _, ok := e.m[stored]; ok {
+			dropping = append(dropping, stored)
+
+			continue
+		}
+
+		missing = append(missing, k)
+	}
+
+	for _, k := range dropping {
+		delete(e.m, k)
+	}
+
+	sort.Strings(missing)
+
+	return missing
+}
+
+// KeepGlob scans the Environ looking for keys matching shell-style glob
+// patterns, as defined by path.Match, and keeps them while dropping all
+// others.
+//
+// It returns the slice of patterns that matched nothing, or an error for
+// a malformed pattern, in which case the Environ is left unchanged.
+func (e *Environ) KeepGlob(patterns ...string) (missing []string, err error) {
+	if err = validGlobs(patterns); err != nil {
+		return nil, err
+	}
+
+	defer e.writeLocker()()
+
+	e.rewrite()
+	matched, missing := matchKeys(e.m, patterns, globMatch)
+
+	keeping := make(map[string]string, len(matched))
+	for _, k := range matched {
+		keeping[k] = e.m[k]
+	}
+
+	e.m = keeping
+
+	return missing, nil
+}
+
+// DropGlob scans the Environ looking for keys matching shell-style glob
+// patterns, as defined by path.Match, and drops them while keeping all
+// others.
+//
+// It returns the slice of patterns that matched nothing, or an error for
+// a malformed pattern, in which case the Environ is left unchanged.
+func (e *Environ) DropGlob(patterns ...string) (missing []string, err error) {
+	if err = validGlobs(patterns); err != nil {
+		return nil, err
+	}
+
+	defer e.writeLocker()()
+
+	e.rewrite()
+	matched, missing := matchKeys(e.m, patterns, globMatch)
+	for _, k := range matched {
+		delete(e.m, k)
+	}
+
+	return missing, nil
+}
+
+func validGlobs(patterns []string) error {
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("glob %q: %w", pattern, err)
+		}
+	}
+
+	return nil
+}
+
+func globMatch(pattern, key string) bool {
+	// patterns are validated up front, so the error can't occur.
+	ok, _ := path.Match(pattern, key)
+
+	return ok
+}
+
+// matchKeys returns the sorted, deduplicated keys of m for which match
+// reports true against any of patterns, and the sorted patterns that
+// matched no key at all.
+func matchKeys(m map[string]string, patterns []string, match func(pattern, key string) bool) (matched []string, missing []string) {
+	matched = make([]string, 0, len(m))
+	missing = make([]string, 0, len(patterns))
 
-	return len(e.m)
-}
+	sorted := keys(m)
+	seen := make(map[string]bool, len(m))
+	for _, pattern := range patterns {
+		var found bool
+		for _, k := range sorted {
+			if !match(pattern, k) {
+				continue
+			}
 
-// MarshalJSON satisfies json.Marshaler interface.
-func (e *Environ) MarshalJSON() ([]byte, error) {
-	defer e.readLocker()()
+			found = true
+			if !seen[k] {
+				seen[k] = true
+				matched = append(matched, k)
+			}
+		}
 
-	return json.Marshal(e.AsSlice())
+		if !found {
+			missing = append(missing, pattern)
+		}
+	}
+
+	sort.Strings(matched)
+	sort.Strings(missing)
+
+	return matched, missing
 }
 
-// UnmarshalJSON satisfies json.Unmarshaler interface.
-func (e *Environ) UnmarshalJSON(data []byte) error {
-	var environ []string
-	if err := json.Unmarshal(data, &environ); err != nil {
-		return err
+// Filter keeps only the variables for which keep returns true, dropping
+// all others. Unlike Keep and Drop it can select on values as well as
+// keys.
+//
+// keep is called under the write lock, so it must not call methods on the
+// Environ.
+func (e *Environ) Filter(keep func(key, value string) bool) {
+	defer e.writeLocker()()
+
+	e.rewrite()
+	for k, v := range e.m {
+		if !keep(k, v) {
+			delete(e.m, k)
+		}
 	}
+}
 
-	*e = *New(environ)
+// ReplaceValues replaces every occurrence of old with replacement in every
+// value, under a single lock, and returns the number of variables changed.
+func (e *Environ) ReplaceValues(old, replacement string) int {
+	return e.replaceValues(func(v string) string {
+		return strings.ReplaceAll(v, old, replacement)
+	})
+}
 
-	return nil
+// ReplaceValuesRegexp replaces every match of re in every value with repl,
+// which may refer to submatches as in regexp.Regexp.ReplaceAllString. It
+// works under a single lock, and returns the number of variables changed.
+func (e *Environ) ReplaceValuesRegexp(re *regexp.Regexp, repl string) int {
+	return e.replaceValues(func(v string) string {
+		return re.ReplaceAllString(v, repl)
+	})
 }
 
-// New creates an Environ from a list of "key=value" strings.
-func New(environ []string) *Environ {
-	return &Environ{
-		l: new(sync.RWMutex),
-		m: envSliceAsMap(environ),
+func (e *Environ) replaceValues(replace func(string) string) int {
+	defer e.writeLocker()()
+
+	e.rewrite()
+
+	var n int
+	for k, v := range e.m {
+		if replaced := replace(v); replaced != v {
+			e.m[k] = replaced
+			n++
+		}
 	}
+
+	return n
 }
 
-// Set updates the Environ, replacing the value at key with val. If
-// such already exists, it'll be clobbered.
-func (e *Environ) Set(key, val string) {
+// NormalizeKeys rewrites every key through transform.
+//
+// If several keys transform to the same name, the value of the key that
+// sorts last lexically wins, so for UpperKeys "path" wins over "PATH" and
+// "Path".
+func (e *Environ) NormalizeKeys(transform func(string) string) {
 	defer e.writeLocker()()
 
-	e.m[key] = val
+	e.rewrite()
+
+	m := make(map[string]string, len(e.m))
+	for _, k := range keys(e.m) {
+		m[transform(k)] = e.m[k]
+	}
+
+	e.m = m
+	e.reindex()
 }
 
-// Unset deletes key's value from the Environ.
-func (e *Environ) Unset(key string) {
+// Transform rebuilds the Environ by passing each variable through fn, which
+// returns the key and value to store in its place, and whether to keep it
+// at all. Variables are visited in lexical key order, and if several map to
+// the same key, the one visited last wins, as with NormalizeKeys.
+//
+// fn is called under the write lock, so it must not call methods on the
+// Environ.
+func (e *Environ) Transform(fn func(key, value string) (newKey, newValue string, keep bool)) {
 	defer e.writeLocker()()
 
-	delete(e.m, key)
+	e.rewrite()
+
+	m := make(map[string]string, len(e.m))
+	for _, k := range keys(e.m) {
+		if nk, nv, ok := fn(k, e.m[k]); ok {
+			m[nk] = nv
+		}
+	}
+
+	e.m = m
+	e.reindex()
 }
 
-// Get retrieves the value in the Environ under key, or "" if missing.
-func (e *Environ) Get(key string) string {
-	defer e.readLocker()()
+// UpperKeys converts every key to upper case, as NormalizeKeys with
+// strings.ToUpper.
+func (e *Environ) UpperKeys() {
+	e.NormalizeKeys(strings.ToUpper)
+}
 
-	return e.m[key]
+// LowerKeys converts every key to lower case, as NormalizeKeys with
+// strings.ToLower.
+func (e *Environ) LowerKeys() {
+	e.NormalizeKeys(strings.ToLower)
 }
 
-// Keep scans the Environ looking for matching patterns and
-// keeps them while dropping all others.
-//
-// It returns the slice of patterns it could not find.
-//
-// All patterns are treated as a regular expression, which will error on
-// compile failures.
-func (e *Environ) Keep(patterns ...string) (missing []string, err error) {
-	m := e.AsMap()
-	missing, err = keep(&m, patterns)
+// DropEmpty drops every variable whose value is the empty string, and
+// returns the sorted slice of keys it dropped.
+func (e *Environ) DropEmpty() []string {
+	defer e.writeLocker()()
+
+	e.rewrite()
+
+	dropped := make([]string, 0)
+	for k, v := range e.m {
+		if v == "" {
+			dropped = append(dropped, k)
+			delete(e.m, k)
+		}
+	}
+
+	sort.Strings(dropped)
+
+	return dropped
+}
+
+func matchingKeys(m map[string]string, patterns []string) (matched []string, missing []string, err error) {
+	regexps, missing, err := compilePatterns(patterns)
 	if err != nil {
-		return missing, err
+		return nil, missing, err
 	}
 
-	defer e.writeLocker()()
+	matched, missing = matchCompiled(m, patterns, regexps)
 
-	e.m = m
+	return matched, missing, nil
+}
 
-	return missing, nil
+// compilePatterns compiles each of patterns with compileAnchored. On
+// failure it returns the offending pattern as missing, with the error.
+func compilePatterns(patterns []string) (regexps map[string]*regexp.Regexp, missing []string, err error) {
+	regexps = make(map[string]*regexp.Regexp, len(patterns))
+	for _, pattern := range patterns {
+		var regex *regexp.Regexp
+
+		regex, err = compileAnchored(pattern)
+		if err != nil {
+			return nil, []string{pattern}, err
+		}
+
+		regexps[pattern] = regex
+	}
+
+	return regexps, nil, nil
 }
 
-func keep(m *map[string]string, patterns []string) (missing []string, err error) {
-	matched, missing, err := matchingKeys(*m, patterns)
-	if err != nil {
-		return missing, err
+func matchCompiled(m map[string]string, patterns []string, regexps map[string]*regexp.Regexp) (matched []string, missing []string) {
+	return matchKeys(m, patterns, func(pattern, key string) bool {
+		return regexps[pattern].MatchString(key)
+	})
+}
+
+// compileAnchored compiles pattern as a regular expression which must match
+// a whole key. Compiled patterns, and the errors of those that fail to
+// compile, are cached, since callers tend to repeat the same few.
+func compileAnchored(pattern string) (*regexp.Regexp, error) {
+	regexCache.Lock()
+	cached, ok := regexCache.m[pattern]
+	regexCache.Unlock()
+
+	if ok {
+		return cached.regex, cached.err
 	}
 
-	keeping := make(map[string]string, len(*m))
-	for _, keepKey := range matched {
-		keeping[keepKey] = (*m)[keepKey]
+	// compile without the lock, so that a slow pattern doesn't hold up
+	// every other caller. Two goroutines may compile the same pattern at
+	// once; the first to store it wins.
+	//
+	// anchor the pattern to prevent weird regexp edge cases.
+	regex, err := regexp.Compile("^" + pattern + "$")
+
+	regexCache.Lock()
+	defer regexCache.Unlock()
+
+	if cached, ok := regexCache.m[pattern]; ok {
+		return cached.regex, cached.err
 	}
 
-	*m = keeping
+	// bound the cache by starting over when it fills, so that a stream of
+	// distinct patterns can't grow it without limit.
+	if len(regexCache.m) >= maxCachedRegexps {
+		regexCache.m = make(map[string]compiledRegexp, maxCachedRegexps)
+	}
 
-	return missing, err
+	regexCache.m[pattern] = compiledRegexp{regex: regex, err: err}
+
+	return regex, err
 }
 
-// Drop scans the Environ looking for matching patterns and
-// drops them while keeping all others.
-//
-// It returns the slice of patterns it could not find.
-//
-// All patterns are treated as a regular expression, which will error on
-// compile failures.
-func (e *Environ) Drop(patterns ...string) (missing []string, err error) {
-	m := e.AsMap()
-	missing, err = drop(m, patterns)
+const maxCachedRegexps = 256
+
+// compiledRegexp is the result of compiling a pattern.
+type compiledRegexp struct {
+	regex *regexp.Regexp
+	err   error
+}
+
+var regexCache = struct {
+	sync.Mutex
+	m map[string]compiledRegexp
+}{
+	m: make(map[string]compiledRegexp, maxCachedRegexps),
+}
+
+// unique returns a new slice of the distinct elements of s, in the order
+// they first appear.
+func unique(s []string) []string {
+	seen := make(map[string]bool, len(s))
+	res := make([]string, 0, len(s))
+	for _, v := range s {
+		if !seen[v] {
+			seen[v] = true
+			res = append(res, v)
+		}
+	}
+
+	return res
+}
+
+// MatchKeys returns the keys matching pattern in lexical order, without
+// modifying the Environ. The pattern is treated as a regular expression
+// which must match the whole key, as in Keep and Drop.
+func (e *Environ) MatchKeys(pattern string) ([]string, error) {
+	regex, err := compileAnchored(pattern)
 	if err != nil {
-		return missing, err
+		return nil, err
 	}
 
-	defer e.writeLocker()()
+	defer e.readLocker()()
 
-	e.m = m
+	matched := make([]string, 0)
+	for _, k := range keys(e.view()) {
+		if regex.MatchString(k) {
+			matched = append(matched, k)
+		}
+	}
 
-	return missing, nil
+	return matched, nil
 }
 
-func drop(m map[string]string, patterns []string) (missing []string, err error) {
-	matched, missing, err := matchingKeys(m, patterns)
+// CountMatching returns the number of keys matching pattern, without
+// building the slice MatchKeys would. The pattern is treated as a regular
+// expression which must match the whole key, as in Keep and Drop.
+func (e *Environ) CountMatching(pattern string) (int, error) {
+	regex, err := compileAnchored(pattern)
 	if err != nil {
-		return missing, err
+		return 0, err
 	}
 
-	for _, dropKey := range matched {
-		delete(m, dropKey)
+	defer e.readLocker()()
+
+	var n int
+	for k := range e.view() {
+		if regex.MatchString(k) {
+			n++
+		}
 	}
 
-	return missing, nil
+	return n, nil
 }
 
-func matchingKeys(m map[string]string, patterns []string) (matched []string, missing []string, err error) {
-	sort.Strings(patterns)
-
-	matched = make([]string, 0, len(m))
-	missing = make([]string, 0, len(patterns))
+// GetMatching returns a new map holding the variables whose keys match
+// pattern, without modifying the Environ. The pattern is treated as a
+// regular expression which must match the whole key, as in Keep and Drop.
+func (e *Environ) GetMatching(pattern string) (map[string]string, error) {
+	regex, err := compileAnchored(pattern)
+	if err != nil {
+		return nil, err
+	}
 
-	regexps := make(map[string]*regexp.Regexp, len(patterns))
-	for _, pattern := range patterns {
-		var regex *regexp.Regexp
+	defer e.readLocker()()
 
-		// anchor the pattern to prevent weird regexp edge cases.
-		regex, err = regexp.Compile("^" + pattern + "$")
-		if err != nil {
-			return nil, []string{pattern}, err
+	matched := make(map[string]string)
+	for k, v := range e.view() {
+		if regex.MatchString(k) {
+			matched[k] = v
 		}
+	}
 
-		regexps[pattern] = regex
+	return matched, nil
+}
+
+// SearchValues returns the keys whose values match pattern in lexical
+// order, without modifying the Environ. Unlike MatchKeys, the pattern is
+// unanchored, so it matches anywhere within a value.
+func (e *Environ) SearchValues(pattern string) ([]string, error) {
+	regex, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
 	}
 
-	for _, pattern := range patterns {
-		var found bool
+	defer e.readLocker()()
 
-		// hold a streak state to stop when we hit the last matching pattern in the
-		// map, since the keys are sorted.
-		var streak bool
-		for _, mKey := range keys(m) {
-			if regexps[pattern].MatchString(mKey) {
-				matched = append(matched, mKey)
-				streak = true
-				// we don't break in this case, as we may
-				// have multiple matches.
-			} else if streak {
-				found = true
-
-				break
-			}
-		}
+	m := e.view()
 
-		if !found {
-			missing = append(missing, pattern)
+	matched := make([]string, 0)
+	for _, k := range keys(m) {
+		if regex.MatchString(m[k]) {
+			matched = append(matched, k)
 		}
 	}
 
-	sort.Strings(matched)
-	sort.Strings(missing)
+	return matched, nil
+}
 
-	return matched, missing, err
+// Range calls fn for each variable in the Environ in lexical key order,
+// stopping early if fn returns false.
+//
+// fn is called under the read lock, so it must not call methods which
+// modify the Environ, or it will deadlock. Collect what needs changing and
+// apply it after Range returns.
+func (e *Environ) Range(fn func(key, value string) bool) {
+	defer e.readLocker()()
+
+	m := e.view()
+	for _, k := range keys(m) {
+		if !fn(k, m[k]) {
+			return
+		}
+	}
 }
 
 // Keys returns the map's keys in lexical order.
 func (e *Environ) Keys() []string {
 	defer e.readLocker()()
 
-	return keys(e.m)
+	return keys(e.view())
 }
 
 func keys(m map[string]string) []string {
@@ -218,11 +1778,38 @@ func keys(m map[string]string) []string {
 	return keys
 }
 
+func keysOf(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
 // AsMap returns a copy of the internal map structre of the Environ.
 func (e *Environ) AsMap() map[string]string {
 	defer e.readLocker()()
 
-	return copyMap(e.m)
+	return copyMap(e.view())
+}
+
+// AsURLValues returns the contents of the Environ as url.Values, with each
+// key holding its value as the only element, for building query strings
+// and form bodies.
+func (e *Environ) AsURLValues() url.Values {
+	defer e.readLocker()()
+
+	m := e.view()
+
+	values := make(url.Values, len(m))
+	for k, v := range m {
+		values[k] = []string{v}
+	}
+
+	return values
 }
 
 func copyMap(e map[string]string) map[string]string {
@@ -237,30 +1824,61 @@ func copyMap(e map[string]string) map[string]string {
 func envSliceAsMap(env []string) map[string]string {
 	m := make(map[string]string, len(env))
 	for _, v := range env {
-		// in case we're reading a .env file with comments or blank lines
-		if strings.HasPrefix(v, "#") || v == "" {
-			continue
-		}
-		if !strings.Contains(v, "=") {
-			continue
-		}
-		kv := strings.SplitN(v, "=", 2)
-		if len(kv) == 2 {
-			m[kv[0]] = kv[1]
-
-			continue
+		if k, v, ok := ParseLine(v); ok {
+			m[k] = v
 		}
 	}
 
 	return m
 }
 
+// ParseLine splits a "key=value" line with the rules New and the other
+// constructors use. ok is false for a comment starting with "#", a blank
+// line, or a line without an "=". Otherwise the key is everything before
+// the first "=" and the value everything after it, without trimming
+// whitespace.
+func ParseLine(line string) (key, value string, ok bool) {
+	// in case we're reading a .env file with comments or blank lines
+	if strings.HasPrefix(line, "#") || line == "" {
+		return "", "", false
+	}
+	if !strings.Contains(line, "=") {
+		return "", "", false
+	}
+	kv := strings.SplitN(line, "=", 2)
+
+	return kv[0], kv[1], true
+}
+
 // AsSlice emits the contents of the Environ as a slice of string
 // with a "key=value" format.
 func (e *Environ) AsSlice() []string {
 	defer e.readLocker()()
 
-	return envMapAsSlice(e.m)
+	return envMapAsSlice(e.view())
+}
+
+// AsSliceSorted behaves like AsSlice, but orders the lines by their keys
+// using less, such as to put PATH ahead of everything else. Keys less
+// considers equal stay in lexical order.
+//
+// less is called under the read lock, so it must not call methods which
+// modify the Environ.
+func (e *Environ) AsSliceSorted(less func(a, b string) bool) []string {
+	defer e.readLocker()()
+
+	m := e.view()
+	sorted := keys(m)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return less(sorted[i], sorted[j])
+	})
+
+	s := make([]string, 0, len(sorted))
+	for _, k := range sorted {
+		s = append(s, k+"="+m[k])
+	}
+
+	return s
 }
 
 func envMapAsSlice(m map[string]string) []string {
@@ -275,6 +1893,73 @@ func envMapAsSlice(m map[string]string) []string {
 	return s
 }
 
+// String satisfies fmt.Stringer, returning the "key=value" lines of
+// AsSlice joined by newlines. The values of keys matching
+// SecretKeyPatterns or registered with RegisterSecret are replaced with
+// "***", so that the output is safer to log; AsSlice and AsMap still hold
+// the real values.
+func (e *Environ) String() string {
+	return e.StringRedacted()
+}
+
+// StringRedacted behaves like String, but also replaces the values of the
+// given keys with "***", for logging environments that hold secrets under
+// names SecretKeyPatterns doesn't cover.
+func (e *Environ) StringRedacted(keys ...string) string {
+	secret := e.secretKeys()
+
+	m := e.AsMap()
+	for k := range m {
+		if secret(k) {
+			m[k] = redacted
+		}
+	}
+
+	for _, k := range keys {
+		if _, ok := m[k]; ok {
+			m[k] = redacted
+		}
+	}
+
+	return strings.Join(envMapAsSlice(m), "\n")
+}
+
+// SecretKeyPatterns holds the patterns of keys whose values String and
+// StringRedacted hide. Each is treated as a regular expression which must
+// match the whole key, as in Keep and Drop; patterns which fail to compile
+// are ignored. Set it to nil to show every value.
+//
+// It isn't guarded by a lock, so change it only during initialization.
+var SecretKeyPatterns = []string{".*_SECRET", ".*_TOKEN", ".*PASSWORD.*", ".*_KEY"}
+
+// secretKeys returns a function reporting whether a key's value should be
+// hidden, because the key matches SecretKeyPatterns or was registered with
+// RegisterSecret.
+func (e *Environ) secretKeys() func(key string) bool {
+	regexps := make([]*regexp.Regexp, 0, len(SecretKeyPatterns))
+	for _, pattern := range SecretKeyPatterns {
+		if regex, err := compileAnchored(pattern); err == nil {
+			regexps = append(regexps, regex)
+		}
+	}
+
+	defer e.readLocker()()
+
+	regexps = append(regexps, e.secrets...)
+
+	return func(key string) bool {
+		for _, regex := range regexps {
+			if regex.MatchString(key) {
+				return true
+			}
+		}
+
+		return false
+	}
+}
+
+const redacted = "***"
+
 type locker interface {
 	RLock()
 	RUnlock()
@@ -289,8 +1974,60 @@ func (e *Environ) readLocker() (unlocker func()) {
 	return e.l.RUnlock
 }
 
+// readLockBoth takes the read locks of two distinct Environs in order of
+// their addresses, so that concurrent calls over the same pair can't
+// deadlock with a waiting writer.
+func readLockBoth(a, b *Environ) (unlocker func()) {
+	if reflect.ValueOf(b).Pointer() < reflect.ValueOf(a).Pointer() {
+		a, b = b, a
+	}
+
+	unlockA := a.readLocker()
+	unlockB := b.readLocker()
+
+	return func() {
+		unlockB()
+		unlockA()
+	}
+}
+
+// readViews returns the merged views of a and b, with a function releasing
+// any locks held while they're in use.
+func readViews(a, b *Environ) (ma, mb map[string]string, unlocker func()) {
+	if a.parent != nil || b.parent != nil {
+		// a Child's view takes its parent's lock, which may already be
+		// held here, so work from copies instead.
+		return a.AsMap(), b.AsMap(), func() {}
+	}
+
+	unlocker = readLockBoth(a, b)
+
+	return a.view(), b.view(), unlocker
+}
+
 func (e *Environ) writeLocker() (unlocker func()) {
+	if e.frozen {
+		panic("environ: modifying a frozen Environ")
+	}
+
 	e.l.Lock()
 
-	return e.l.Unlock
+	return func() {
+		if e.before != nil {
+			e.pending = append(e.pending, changeEvents(e.before, e.m)...)
+			e.before = nil
+		}
+
+		events, observers := e.pending, e.observers
+		e.pending = nil
+
+		// every mutation goes through here, so this keeps Len in step
+		// with the map before any other writer can get in.
+		atomic.StoreInt64(&e.size, int64(len(e.m)))
+		e.l.Unlock()
+
+		for i := range events {
+			e.notify(&events[i], observers)
+		}
+	}
 }
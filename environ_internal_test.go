@@ -1,6 +1,13 @@
 package environ
 
 import (
+	"fmt"
+	"hash/fnv"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
 	"testing"
 )
 
@@ -13,14 +20,89 @@ func TestLocks(t *testing.T) {
 
 	_ = a.Len()
 	_ = a.Keys()
+	_, _ = a.MatchKeys("A")
+	_, _ = a.CountMatching("A")
+	_, _ = a.SearchValues("A")
+	_, _ = a.GetMatching("A")
+	_ = a.EncodeJSON(io.Discard)
+	_ = a.UnsetAll("A")
+	_ = a.ReplaceValues("A", "B")
+	_ = a.ExpandSlice([]string{"$A"})
+	_, _, _ = a.KeepBestEffort("A")
+	_, _, _ = a.DropBestEffort("A")
+	_ = a.SizeBytes()
+	_ = a.AsSliceSorted(func(a, b string) bool { return a < b })
+	_ = a.KeysOrdered()
+	_ = a.AsSliceOrdered()
+	a.Range(func(_, _ string) bool { return true })
 	_ = a.AsSlice()
 	_ = a.AsMap()
+	_ = a.Clone()
+	c := a.Child()
+	c.Set("C", "C")
+	c.Unset("A")
+	_ = c.Get("A")
+	_ = c.Len()
+	_ = c.AsSlice()
+	_ = c.Equal(a)
+	c.Clear()
 	_, _ = a.Keep("A")
 	_, _ = a.Drop("A")
+	_, _, _ = a.Subset("A")
+	_ = a.KeepRegexp(regexp.MustCompile("A"))
+	_ = a.DropRegexp(regexp.MustCompile("A"))
+	_ = a.WithPrefix("A")
+	_ = a.StripPrefix("A")
+	_ = a.PathElements("A")
+	a.AppendPath("A", "A")
+	_ = a.KeepLiteral("A")
+	_ = a.DropLiteral("A")
+	_, _ = a.KeepGlob("A*")
+	_, _ = a.DropGlob("A*")
+	a.Filter(func(_, _ string) bool { return true })
+	_ = a.DropEmpty()
+	a.UpperKeys()
 	_, _ = a.MarshalJSON()
+	_, _ = a.MarshalTOML()
+	_ = a.ExportScript()
+	_ = a.RegisterSecret("A")
+	_, _ = a.MarshalJSONRedacted()
 	_ = a.Get("A")
+	_, _ = a.GetOK("A")
+	_ = a.Has("A")
+	_ = a.Equal(New(nil))
+	_, _, _ = a.Diff(New(nil))
+	_ = a.Intersect(New(nil))
+	_, _ = a.DeltaTo(New(nil))
+	_ = a.EqualIgnoring(New(nil), "A")
+	_, _, _ = a.KeepDryRun("A")
+	_, _ = a.KeepContains("A")
+	_, _ = a.DropContains("A")
+	a.Transform(func(k, v string) (string, string, bool) { return k, v, true })
+	a.AppendToList("A", "a", ",")
+	_ = a.ListElements("A", ",")
+	_ = a.AsURLValues()
+	_ = a.Lookup("A", "B")
+	a.OnChange(func(ChangeEvent) {})
 	a.Set("B", "B")
+	_ = a.SetIfAbsent("B", "B")
+	a.SetAll(map[string]string{"B": "B"})
+	_ = a.Rename("B", "C")
 	a.Unset("B")
+	a.Clear()
+	a.Merge(a)
+	_ = a.Expand("$A")
+	a.ExpandAll()
+	_ = a.GetExpanded("A")
+
+	envFile := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(envFile, []byte("C=C\n"), 0o600); err != nil {
+		t.Fatalf("writing test file: %v", err)
+	}
+	_ = a.MergeFile(envFile)
+	_ = a.WriteFile(envFile, 0o600)
+	_, _ = a.WriteTo(io.Discard)
+	_ = a.UnmarshalJSON([]byte(`["A=A"]`))
 
 	if fl.locks != 0 {
 		t.Errorf("locks was non-zero %d, search for 'writeLocker\\(\\)$' and add additional parens", fl.locks)
@@ -31,6 +113,78 @@ func TestLocks(t *testing.T) {
 	}
 }
 
+func TestCompileAnchoredCache(t *testing.T) {
+	a, err := compileAnchored("CACHE_.*")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	b, err := compileAnchored("CACHE_.*")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if a != b {
+		t.Errorf("expected the compiled pattern to be reused")
+	}
+
+	if !a.MatchString("CACHE_A") || a.MatchString("X_CACHE_A") {
+		t.Errorf("expected the cached pattern to be anchored")
+	}
+
+	if _, err = compileAnchored(`CACHE_\K`); err == nil {
+		t.Fatalf("expected an error which did not occur")
+	}
+
+	regexCache.Lock()
+	cached, ok := regexCache.m[`CACHE_\K`]
+	regexCache.Unlock()
+
+	if !ok || cached.err == nil {
+		t.Errorf("expected the compile error to be cached")
+	}
+
+	if _, again := compileAnchored(`CACHE_\K`); again != cached.err {
+		t.Errorf("expected the cached error to be returned: %v", again)
+	}
+
+	for i := 0; i < maxCachedRegexps*2; i++ {
+		if _, err = compileAnchored(fmt.Sprintf("P%d", i)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	if n := len(regexCache.m); n > maxCachedRegexps {
+		t.Errorf("cache grew past its bound: %d", n)
+	}
+}
+
+var benchPatterns = []string{"PATH", "HOME", "GITHUB_.*", "SSH_.*", ".*PASSWORD", "TOOL_.*"}
+
+func BenchmarkCompileAnchored(b *testing.B) {
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		for _, pattern := range benchPatterns {
+			if _, err := compileAnchored(pattern); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkCompileAnchoredUncached(b *testing.B) {
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		for _, pattern := range benchPatterns {
+			if _, err := regexp.Compile("^" + pattern + "$"); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
 type fakeLocker struct {
 	rlocks, locks int
 }
@@ -50,3 +204,62 @@ func (f *fakeLocker) Lock() {
 func (f *fakeLocker) Unlock() {
 	f.locks--
 }
+
+// shardedMap is the per-key locking layout considered as a replacement for
+// the single lock: keys hash into buckets which each carry their own lock.
+// It only exists to compare against Environ in BenchmarkParallelSet.
+//
+// Environ keeps the single lock because most of its API works on the whole
+// set at once (Keep, Drop, Filter, ExpandAll, Child layering, Equal, and
+// the case-insensitive lookup), and each of those would have to take every
+// shard's lock in order, which costs more than the contention it saves.
+type shardedMap struct {
+	shards [16]struct {
+		sync.RWMutex
+		m map[string]string
+	}
+}
+
+func newShardedMap() *shardedMap {
+	s := new(shardedMap)
+	for i := range s.shards {
+		s.shards[i].m = make(map[string]string)
+	}
+
+	return s
+}
+
+func (s *shardedMap) Set(key, value string) {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	shard := &s.shards[h.Sum32()%uint32(len(s.shards))]
+
+	shard.Lock()
+	shard.m[key] = value
+	shard.Unlock()
+}
+
+func BenchmarkParallelSet(b *testing.B) {
+	keys := make([]string, 1024)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("KEY_%d", i)
+	}
+
+	run := func(b *testing.B, set func(k, v string)) {
+		b.RunParallel(func(pb *testing.PB) {
+			var i int
+			for pb.Next() {
+				set(keys[i%len(keys)], "value")
+				i++
+			}
+		})
+	}
+
+	b.Run("single-lock", func(b *testing.B) {
+		run(b, New(nil).Set)
+	})
+
+	b.Run("sharded", func(b *testing.B) {
+		run(b, newShardedMap().Set)
+	})
+}
@@ -1,7 +1,15 @@
 package environ_test
 
 import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
 	"reflect"
+	"regexp"
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/metrumresearchgroup/environ"
@@ -77,6 +85,31 @@ func TestSkipNoEquals(t *testing.T) {
 	}
 }
 
+func TestParseLine(t *testing.T) {
+	type parsed struct {
+		key, value string
+		ok         bool
+	}
+
+	for line, want := range map[string]parsed{
+		"A=B":      {"A", "B", true},
+		"A=B=C":    {"A", "B=C", true},
+		"A=":       {"A", "", true},
+		"=B":       {"", "B", true},
+		" A = B ":  {" A ", " B ", true},
+		"#A=B":     {},
+		"":         {},
+		"NOEQUALS": {},
+	} {
+		var got parsed
+		got.key, got.value, got.ok = environ.ParseLine(line)
+
+		if got != want {
+			t.Fatalf("%q: expected %+v, got %+v", line, want, got)
+		}
+	}
+}
+
 func TestCatchBadRegex(t *testing.T) {
 	e := environ.New([]string{"A", "B=B", "C="})
 	missing, err := e.Drop(`unsupported\K`)
@@ -134,6 +167,61 @@ func TestKeys(t *testing.T) {
 	}
 }
 
+func TestAsSliceSorted(t *testing.T) {
+	env := environ.New([]string{"A=A", "PATH=/bin", "C=C", "B=B"})
+
+	pathFirst := func(a, b string) bool {
+		return a == "PATH" && b != "PATH"
+	}
+
+	got := env.AsSliceSorted(pathFirst)
+	if !reflect.DeepEqual(got, []string{"PATH=/bin", "A=A", "B=B", "C=C"}) {
+		t.Fatalf("unexpected slice: %v", got)
+	}
+
+	got = env.AsSliceSorted(func(a, b string) bool { return a > b })
+	if !reflect.DeepEqual(got, []string{"PATH=/bin", "C=C", "B=B", "A=A"}) {
+		t.Fatalf("unexpected slice: %v", got)
+	}
+}
+
+func TestAsURLValues(t *testing.T) {
+	env := environ.New([]string{"A=1", "B=two words", "C="})
+
+	values := env.AsURLValues()
+	if !reflect.DeepEqual(values, url.Values{"A": {"1"}, "B": {"two words"}, "C": {""}}) {
+		t.Fatalf("unexpected values: %v", values)
+	}
+
+	if got := values.Encode(); got != "A=1&B=two+words&C=" {
+		t.Fatalf("unexpected encoding: %q", got)
+	}
+}
+
+func TestEncodeJSON(t *testing.T) {
+	for _, lines := range [][]string{
+		nil,
+		{"A=A"},
+		{"A=A", "B=<b> & \"quoted\"", "C=line\nbreak"},
+	} {
+		env := environ.New(lines)
+
+		var buf bytes.Buffer
+		if err := env.EncodeJSON(&buf); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		marshaled, err := env.MarshalJSON()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if buf.String() != string(marshaled)+"\n" {
+			t.Fatalf("expected %s, got %s", marshaled, buf.String())
+		}
+	}
+}
+
 func TestUnmarshalFailure(t *testing.T) {
 	env := new(environ.Environ)
 	err := env.UnmarshalJSON([]byte(`{"A":"A","B"}`))
@@ -144,3 +232,1518 @@ func TestUnmarshalFailure(t *testing.T) {
 		t.Fatalf("error incorrect, got: %v", err)
 	}
 }
+
+func restoreOSEnv(t *testing.T) {
+	t.Helper()
+
+	orig := os.Environ()
+	t.Cleanup(func() {
+		if err := environ.New(orig).ApplyToOSExclusive(); err != nil {
+			t.Fatalf("restoring environment: %v", err)
+		}
+	})
+}
+
+func TestApplyToOS(t *testing.T) {
+	restoreOSEnv(t)
+
+	env := environ.New([]string{"ENVIRON_TEST_A=A", "ENVIRON_TEST_B="})
+	if err := env.ApplyToOS(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got := os.Getenv("ENVIRON_TEST_A"); got != "A" {
+		t.Fatalf("ENVIRON_TEST_A not applied, got: %q", got)
+	}
+
+	if _, ok := os.LookupEnv("ENVIRON_TEST_B"); !ok {
+		t.Fatalf("ENVIRON_TEST_B not applied")
+	}
+
+	if len(os.Environ()) <= env.Len() {
+		t.Fatalf("expected existing OS variables to be kept")
+	}
+}
+
+func TestApplyToOSExclusive(t *testing.T) {
+	restoreOSEnv(t)
+
+	env := environ.New([]string{"ENVIRON_TEST_A=A", "ENVIRON_TEST_B=B"})
+	if err := env.ApplyToOSExclusive(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !reflect.DeepEqual(environ.FromOS().AsSlice(), env.AsSlice()) {
+		t.Fatalf("unexpected OS environment: %v", os.Environ())
+	}
+}
+
+func TestWithEnv(t *testing.T) {
+	restoreOSEnv(t)
+
+	orig := environ.FromOS()
+	env := environ.New([]string{"ENVIRON_TEST_A=A"})
+
+	var during []string
+	err := environ.WithEnv(env, func() {
+		during = os.Environ()
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !reflect.DeepEqual(during, []string{"ENVIRON_TEST_A=A"}) {
+		t.Fatalf("unexpected environment during fn: %v", during)
+	}
+
+	if !environ.FromOS().Equal(orig) {
+		t.Fatalf("environment wasn't restored: %v", os.Environ())
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatalf("expected the panic to propagate")
+			}
+		}()
+
+		_ = environ.WithEnv(env, func() {
+			panic("fn failed")
+		})
+	}()
+
+	if !environ.FromOS().Equal(orig) {
+		t.Fatalf("environment wasn't restored after a panic: %v", os.Environ())
+	}
+
+	bad := environ.New(nil)
+	bad.Set("", "empty key")
+
+	called := false
+	if err = environ.WithEnv(bad, func() { called = true }); err == nil || called {
+		t.Fatalf("expected an error without calling fn, got %v, called %v", err, called)
+	}
+
+	if !environ.FromOS().Equal(orig) {
+		t.Fatalf("environment wasn't restored after an error: %v", os.Environ())
+	}
+}
+
+func TestClone(t *testing.T) {
+	orig := environ.New([]string{"A=A", "B=B"})
+	clone := orig.Clone()
+
+	clone.Set("A", "Apple")
+	clone.Unset("B")
+	orig.Set("C", "C")
+
+	if !reflect.DeepEqual(orig.AsSlice(), []string{"A=A", "B=B", "C=C"}) {
+		t.Fatalf("orig was modified: %v", orig.AsSlice())
+	}
+
+	if !reflect.DeepEqual(clone.AsSlice(), []string{"A=Apple"}) {
+		t.Fatalf("unexpected clone: %v", clone.AsSlice())
+	}
+}
+
+func TestSizeBytes(t *testing.T) {
+	env := environ.New([]string{"A=A", "BB=", "CCC=ccc"})
+	if n := env.SizeBytes(); n != 3+3+7 {
+		t.Fatalf("unexpected size: %d", n)
+	}
+
+	if n := environ.New(nil).SizeBytes(); n != 0 {
+		t.Fatalf("unexpected size of empty environ: %d", n)
+	}
+}
+
+func TestNewChecked(t *testing.T) {
+	env, duplicates := environ.NewChecked([]string{"B=1", "A=1", "B=2", "# B=3", "C=C", "A=1", "B=4"})
+
+	if !reflect.DeepEqual(env.AsSlice(), []string{"A=1", "B=4", "C=C"}) {
+		t.Fatalf("unexpected slice: %v", env.AsSlice())
+	}
+
+	if !reflect.DeepEqual(duplicates, []string{"A", "B"}) {
+		t.Fatalf("unexpected duplicates: %v", duplicates)
+	}
+
+	if _, duplicates = environ.NewChecked([]string{"A=A"}); len(duplicates) != 0 {
+		t.Fatalf("unexpected duplicates: %v", duplicates)
+	}
+}
+
+func TestNewWithCapacity(t *testing.T) {
+	for _, extra := range []int{-1, 0, 100} {
+		env := environ.NewWithCapacity([]string{"A=A", "# comment", "B=B"}, extra)
+		env.Set("C", "C")
+
+		if !reflect.DeepEqual(env.AsSlice(), []string{"A=A", "B=B", "C=C"}) {
+			t.Fatalf("unexpected environ with extra %d: %v", extra, env.AsSlice())
+		}
+	}
+}
+
+func TestNewFromMap(t *testing.T) {
+	m := map[string]string{"A": "A", "B": "B"}
+	env := environ.NewFromMap(m)
+
+	m["A"] = "Apple"
+	delete(m, "B")
+	env.Set("C", "C")
+
+	if !reflect.DeepEqual(env.AsSlice(), []string{"A=A", "B=B", "C=C"}) {
+		t.Fatalf("unexpected environ: %v", env.AsSlice())
+	}
+
+	if env.Len() != 3 {
+		t.Fatalf("unexpected length: %d", env.Len())
+	}
+
+	if len(m) != 1 {
+		t.Fatalf("caller's map was modified: %v", m)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	env := environ.New([]string{"A=A", "B=B"})
+	env.Merge(environ.New([]string{"B=Bee", "C=C"}))
+
+	if !reflect.DeepEqual(env.AsSlice(), []string{"A=A", "B=Bee", "C=C"}) {
+		t.Fatalf("unexpected slice: %v", env.AsSlice())
+	}
+
+	env.Merge(env)
+
+	if !reflect.DeepEqual(env.AsSlice(), []string{"A=A", "B=Bee", "C=C"}) {
+		t.Fatalf("self merge changed values: %v", env.AsSlice())
+	}
+}
+
+func TestMergeSlice(t *testing.T) {
+	env := environ.New([]string{"A=A", "B=B"})
+	env.MergeSlice([]string{"B=Bee", "# comment", "no equals", "C=C=C"})
+
+	if !reflect.DeepEqual(env.AsSlice(), []string{"A=A", "B=Bee", "C=C=C"}) {
+		t.Fatalf("unexpected slice: %v", env.AsSlice())
+	}
+}
+
+func TestMergeFunc(t *testing.T) {
+	sep := string(os.PathListSeparator)
+	env := environ.New([]string{"PATH=/bin", "A=A"})
+
+	env.MergeFunc(environ.New([]string{"PATH=/usr/bin", "B=B"}), func(key, existing, incoming string) string {
+		if key == "PATH" {
+			return strings.Join([]string{existing, incoming}, sep)
+		}
+
+		return incoming
+	})
+
+	want := []string{"A=A", "B=B", "PATH=/bin" + sep + "/usr/bin"}
+	if !reflect.DeepEqual(env.AsSlice(), want) {
+		t.Fatalf("unexpected slice: %v", env.AsSlice())
+	}
+}
+
+func TestGetOK(t *testing.T) {
+	env := environ.New([]string{"A=A", "B="})
+
+	for _, tc := range []struct {
+		key   string
+		value string
+		ok    bool
+	}{
+		{key: "A", value: "A", ok: true},
+		{key: "B", value: "", ok: true},
+		{key: "C", value: "", ok: false},
+	} {
+		value, ok := env.GetOK(tc.key)
+		if value != tc.value || ok != tc.ok {
+			t.Fatalf("GetOK(%q) = %q, %v; expected %q, %v", tc.key, value, ok, tc.value, tc.ok)
+		}
+	}
+}
+
+func TestHas(t *testing.T) {
+	env := environ.New([]string{"A=A", "B="})
+
+	if !env.Has("A") || !env.Has("B") {
+		t.Fatalf("expected A and B to be present")
+	}
+
+	if env.Has("C") {
+		t.Fatalf("expected C to be absent")
+	}
+}
+
+func TestKeepDropLiteral(t *testing.T) {
+	env := environ.New([]string{"MY.VAR=1", "MYXVAR=2", "B=B", "C=C"})
+
+	missing := env.KeepLiteral("MY.VAR", "B", "E", "C")
+	if !reflect.DeepEqual(env.AsSlice(), []string{"B=B", "C=C", "MY.VAR=1"}) {
+		t.Fatalf("didn't keep correct values: %v", env.AsSlice())
+	}
+
+	if !reflect.DeepEqual(missing, []string{"E"}) {
+		t.Fatalf("unexpected missing: %v", missing)
+	}
+
+	missing = env.DropLiteral("MY.VAR", "D", "B", "B", "D")
+	if !reflect.DeepEqual(env.AsSlice(), []string{"C=C"}) {
+		t.Fatalf("didn't drop correct values: %v", env.AsSlice())
+	}
+
+	if !reflect.DeepEqual(missing, []string{"D"}) {
+		t.Fatalf("unexpected missing: %v", missing)
+	}
+
+	missing = env.KeepLiteral("C", "C", "E", "E")
+	if !reflect.DeepEqual(env.AsSlice(), []string{"C=C"}) || !reflect.DeepEqual(missing, []string{"E"}) {
+		t.Fatalf("unexpected keep with duplicates: %v, missing %v", env.AsSlice(), missing)
+	}
+}
+
+func TestKeepDropKeys(t *testing.T) {
+	env := environ.New([]string{"A.*=1", "AB=2", "B=B", "C=C"})
+
+	missing := env.KeepKeys([]string{"A.*", "B", "C", "Z"})
+	if !reflect.DeepEqual(env.AsSlice(), []string{"A.*=1", "B=B", "C=C"}) {
+		t.Fatalf("didn't keep correct values: %v", env.AsSlice())
+	}
+
+	if !reflect.DeepEqual(missing, []string{"Z"}) {
+		t.Fatalf("unexpected missing: %v", missing)
+	}
+
+	missing = env.DropKeys([]string{"A.*", "Y", "A.*", "Y"})
+	if !reflect.DeepEqual(env.AsSlice(), []string{"B=B", "C=C"}) {
+		t.Fatalf("didn't drop correct values: %v", env.AsSlice())
+	}
+
+	if !reflect.DeepEqual(missing, []string{"Y"}) {
+		t.Fatalf("unexpected missing: %v", missing)
+	}
+}
+
+func TestDropExcept(t *testing.T) {
+	env := environ.New([]string{"MY.VAR=1", "MYXVAR=2", "B=B"})
+
+	missing := env.DropExcept("MY.VAR", "Z")
+	if !reflect.DeepEqual(env.AsSlice(), []string{"MY.VAR=1"}) {
+		t.Fatalf("didn't drop correct values: %v", env.AsSlice())
+	}
+
+	if !reflect.DeepEqual(missing, []string{"Z"}) {
+		t.Fatalf("unexpected missing: %v", missing)
+	}
+}
+
+func TestKeepDropGlob(t *testing.T) {
+	env := environ.New([]string{"AWS_REGION=r", "AWS_KEY=k", "GOPATH=p", "GOROOT=r", "GOOS=o", "HOME=h"})
+
+	missing, err := env.KeepGlob("AWS_*", "GO????", "AZURE_*")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !reflect.DeepEqual(env.AsSlice(), []string{"AWS_KEY=k", "AWS_REGION=r", "GOPATH=p", "GOROOT=r"}) {
+		t.Fatalf("didn't keep correct values: %v", env.AsSlice())
+	}
+
+	if !reflect.DeepEqual(missing, []string{"AZURE_*"}) {
+		t.Fatalf("unexpected missing: %v", missing)
+	}
+
+	missing, err = env.DropGlob("*_KEY", "GO[PX]*", "HOME")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !reflect.DeepEqual(env.AsSlice(), []string{"AWS_REGION=r", "GOROOT=r"}) {
+		t.Fatalf("didn't drop correct values: %v", env.AsSlice())
+	}
+
+	if !reflect.DeepEqual(missing, []string{"HOME"}) {
+		t.Fatalf("unexpected missing: %v", missing)
+	}
+}
+
+func TestGlobBadPattern(t *testing.T) {
+	env := environ.New([]string{"A=A", "B=B"})
+
+	if _, err := env.KeepGlob("A", "B["); err == nil {
+		t.Fatalf("expected an error which did not occur")
+	}
+
+	if _, err := env.DropGlob("A", "B["); err == nil {
+		t.Fatalf("expected an error which did not occur")
+	}
+
+	if !reflect.DeepEqual(env.AsSlice(), []string{"A=A", "B=B"}) {
+		t.Fatalf("environ was modified: %v", env.AsSlice())
+	}
+}
+
+func TestKeepDropReport(t *testing.T) {
+	env := environ.New([]string{"A=A", "B=B", "C=C", "A_A=AA", "A_B=AB"})
+
+	kept, missing, err := env.KeepReport("A", "A_.*", "A_A", "B", "E")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !reflect.DeepEqual(kept, []string{"A", "A_A", "A_B", "B"}) {
+		t.Fatalf("unexpected kept: %v", kept)
+	}
+
+	if !reflect.DeepEqual(missing, []string{"E"}) {
+		t.Fatalf("unexpected missing: %v", missing)
+	}
+
+	dropped, missing, err := env.DropReport("A_.*", "D")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !reflect.DeepEqual(dropped, []string{"A_A", "A_B"}) {
+		t.Fatalf("unexpected dropped: %v", dropped)
+	}
+
+	if !reflect.DeepEqual(missing, []string{"D"}) {
+		t.Fatalf("unexpected missing: %v", missing)
+	}
+
+	if !reflect.DeepEqual(env.AsSlice(), []string{"A=A", "B=B"}) {
+		t.Fatalf("unexpected slice: %v", env.AsSlice())
+	}
+}
+
+func TestKeepDropNonContiguousMatches(t *testing.T) {
+	env := environ.New([]string{"A=A", "AB=AB", "B=B", "BA=BA", "C=C", "CA=CA"})
+
+	missing, err := env.Keep(".*A.*")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !reflect.DeepEqual(env.AsSlice(), []string{"A=A", "AB=AB", "BA=BA", "CA=CA"}) {
+		t.Fatalf("didn't keep correct values: %v", env.AsSlice())
+	}
+
+	if len(missing) != 0 {
+		t.Fatalf("unexpected missing: %v", missing)
+	}
+
+	missing, err = env.Drop(".*B.*", "Z")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !reflect.DeepEqual(env.AsSlice(), []string{"A=A", "CA=CA"}) {
+		t.Fatalf("didn't drop correct values: %v", env.AsSlice())
+	}
+
+	if !reflect.DeepEqual(missing, []string{"Z"}) {
+		t.Fatalf("unexpected missing: %v", missing)
+	}
+}
+
+func TestMissingPatternMatchingLastKey(t *testing.T) {
+	lines := []string{"A=A", "B=B", "Z=Z"}
+
+	env := environ.New(lines)
+	missing, err := env.Keep("Z", "NONE")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !reflect.DeepEqual(env.AsSlice(), []string{"Z=Z"}) || !reflect.DeepEqual(missing, []string{"NONE"}) {
+		t.Fatalf("unexpected keep result: %v, missing %v", env.AsSlice(), missing)
+	}
+
+	env = environ.New(lines)
+	missing, err = env.Drop("Z")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !reflect.DeepEqual(env.AsSlice(), []string{"A=A", "B=B"}) || len(missing) != 0 {
+		t.Fatalf("unexpected drop result: %v, missing %v", env.AsSlice(), missing)
+	}
+
+	_, missing, err = environ.New(lines).Subset("[BZ]")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(missing) != 0 {
+		t.Fatalf("unexpected missing: %v", missing)
+	}
+
+	_, missing, err = environ.New(nil).Subset("Z")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !reflect.DeepEqual(missing, []string{"Z"}) {
+		t.Fatalf("expected every pattern missing from an empty environ: %v", missing)
+	}
+}
+
+func TestKeepDropContains(t *testing.T) {
+	env := environ.New([]string{"AWS=1", "AWS_REGION=us", "MY_AWS_KEY=k", "HOME=/home", "PATH=/bin"})
+
+	missing, err := env.KeepContains("AWS", "PATH", "Z")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !reflect.DeepEqual(env.AsSlice(), []string{"AWS=1", "AWS_REGION=us", "MY_AWS_KEY=k", "PATH=/bin"}) {
+		t.Fatalf("didn't keep correct values: %v", env.AsSlice())
+	}
+
+	if !reflect.DeepEqual(missing, []string{"Z"}) {
+		t.Fatalf("unexpected missing: %v", missing)
+	}
+
+	if missing, err = env.DropContains("^AWS", "ZZ"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !reflect.DeepEqual(env.AsSlice(), []string{"MY_AWS_KEY=k", "PATH=/bin"}) {
+		t.Fatalf("didn't drop correct values: %v", env.AsSlice())
+	}
+
+	if !reflect.DeepEqual(missing, []string{"ZZ"}) {
+		t.Fatalf("unexpected missing: %v", missing)
+	}
+
+	if missing, err = env.KeepContains(`bad\K`); err == nil || !reflect.DeepEqual(missing, []string{`bad\K`}) {
+		t.Fatalf("expected a compile error, got %v, %v", missing, err)
+	}
+
+	if env.Len() != 2 {
+		t.Fatalf("environ was modified by a failed keep: %v", env.AsSlice())
+	}
+}
+
+func TestKeepDryRun(t *testing.T) {
+	env := environ.New([]string{"A=A", "AB=AB", "B=B", "C=C"})
+
+	perPattern, missing, err := env.KeepDryRun("A.*", ".*B", "Z")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := map[string][]string{
+		"A.*": {"A", "AB"},
+		".*B": {"AB", "B"},
+		"Z":   {},
+	}
+	if !reflect.DeepEqual(perPattern, want) {
+		t.Fatalf("unexpected matches: %v", perPattern)
+	}
+
+	if !reflect.DeepEqual(missing, []string{"Z"}) {
+		t.Fatalf("unexpected missing: %v", missing)
+	}
+
+	if env.Len() != 4 {
+		t.Fatalf("environ was modified: %v", env.AsSlice())
+	}
+
+	if _, missing, err = env.KeepDryRun("A", `bad\K`); err == nil || !reflect.DeepEqual(missing, []string{`bad\K`}) {
+		t.Fatalf("expected a compile error for the bad pattern, got %v, %v", missing, err)
+	}
+}
+
+func TestKeepDropBestEffort(t *testing.T) {
+	env := environ.New([]string{"A=A", "AB=AB", "B=B", "C=C"})
+
+	missing, invalid, err := env.KeepBestEffort("A.*", `bad\K`, "B", "Z")
+	if err == nil {
+		t.Fatalf("expected a compile error which did not occur")
+	}
+
+	if !reflect.DeepEqual(env.AsSlice(), []string{"A=A", "AB=AB", "B=B"}) {
+		t.Fatalf("didn't keep correct values: %v", env.AsSlice())
+	}
+
+	if !reflect.DeepEqual(missing, []string{"Z"}) || !reflect.DeepEqual(invalid, []string{`bad\K`}) {
+		t.Fatalf("unexpected missing %v or invalid %v", missing, invalid)
+	}
+
+	missing, invalid, err = env.DropBestEffort("AB", `(`, "Y")
+	if err == nil {
+		t.Fatalf("expected a compile error which did not occur")
+	}
+
+	if !reflect.DeepEqual(env.AsSlice(), []string{"A=A", "B=B"}) {
+		t.Fatalf("didn't drop correct values: %v", env.AsSlice())
+	}
+
+	if !reflect.DeepEqual(missing, []string{"Y"}) || !reflect.DeepEqual(invalid, []string{"("}) {
+		t.Fatalf("unexpected missing %v or invalid %v", missing, invalid)
+	}
+
+	if _, invalid, err = env.DropBestEffort("A"); err != nil || len(invalid) != 0 {
+		t.Fatalf("unexpected invalid %v or error %v", invalid, err)
+	}
+
+	missing, invalid, err = env.KeepBestEffort("[", "(")
+	if err == nil || !reflect.DeepEqual(invalid, []string{"(", "["}) || len(missing) != 0 {
+		t.Fatalf("unexpected missing %v, invalid %v or error %v", missing, invalid, err)
+	}
+
+	if !reflect.DeepEqual(env.AsSlice(), []string{"B=B"}) {
+		t.Fatalf("expected no change when no pattern compiles: %v", env.AsSlice())
+	}
+}
+
+func TestKeepDoesNotReorderPatterns(t *testing.T) {
+	env := environ.New([]string{"A=A", "B=B"})
+
+	patterns := []string{"B", "A"}
+	if _, err := env.Keep(patterns...); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !reflect.DeepEqual(patterns, []string{"B", "A"}) {
+		t.Fatalf("caller's patterns were modified: %v", patterns)
+	}
+}
+
+func TestFilter(t *testing.T) {
+	env := environ.New([]string{"A=1", "B=two", "C=3", "D="})
+
+	env.Filter(func(key, value string) bool {
+		return value != "" && strings.Trim(value, "0123456789") == ""
+	})
+
+	if !reflect.DeepEqual(env.AsSlice(), []string{"A=1", "C=3"}) {
+		t.Fatalf("unexpected slice: %v", env.AsSlice())
+	}
+}
+
+func TestReplaceValues(t *testing.T) {
+	env := environ.New([]string{
+		"DB=postgres://old.example.com:5432",
+		"API=https://old.example.com/api",
+		"OTHER=unrelated",
+	})
+
+	if n := env.ReplaceValues("old.example.com", "new.example.com"); n != 2 {
+		t.Fatalf("expected 2 changes, got %d", n)
+	}
+
+	if n := env.ReplaceValuesRegexp(regexp.MustCompile(`:(\d+)$`), ":1${1}"); n != 1 {
+		t.Fatalf("expected 1 change, got %d", n)
+	}
+
+	want := []string{
+		"API=https://new.example.com/api",
+		"DB=postgres://new.example.com:15432",
+		"OTHER=unrelated",
+	}
+	if !reflect.DeepEqual(env.AsSlice(), want) {
+		t.Fatalf("unexpected slice: %v", env.AsSlice())
+	}
+
+	if n := env.ReplaceValues("missing", "x"); n != 0 {
+		t.Fatalf("expected no changes, got %d", n)
+	}
+}
+
+func TestRange(t *testing.T) {
+	env := environ.New([]string{"C=C", "A=A", "B=B"})
+
+	var visited []string
+	env.Range(func(key, value string) bool {
+		visited = append(visited, key+"="+value)
+
+		return key != "B"
+	})
+
+	if !reflect.DeepEqual(visited, []string{"A=A", "B=B"}) {
+		t.Fatalf("unexpected visits: %v", visited)
+	}
+}
+
+func TestString(t *testing.T) {
+	env := environ.New([]string{"B=B", "A=A", "TOKEN=hunter2"})
+
+	if got := env.String(); got != "A=A\nB=B\nTOKEN=hunter2" {
+		t.Fatalf("unexpected string: %q", got)
+	}
+
+	if got := env.StringRedacted("TOKEN", "MISSING"); got != "A=A\nB=B\nTOKEN=***" {
+		t.Fatalf("unexpected redacted string: %q", got)
+	}
+
+	if got := env.Get("TOKEN"); got != "hunter2" {
+		t.Fatalf("redaction modified the value: %q", got)
+	}
+}
+
+func TestStringSecretKeyPatterns(t *testing.T) {
+	env := environ.New([]string{
+		"API_TOKEN=t",
+		"AWS_SECRET=s",
+		"DB_PASSWORD_FILE=/run/pw",
+		"SSH_KEY=k",
+		"KEYBOARD=us",
+		"USER=me",
+	})
+
+	want := "API_TOKEN=***\nAWS_SECRET=***\nDB_PASSWORD_FILE=***\nKEYBOARD=us\nSSH_KEY=***\nUSER=me"
+	if got := env.String(); got != want {
+		t.Fatalf("unexpected string: %q", got)
+	}
+
+	if got := env.StringRedacted("USER"); !strings.Contains(got, "USER=***") || !strings.Contains(got, "SSH_KEY=***") {
+		t.Fatalf("unexpected redacted string: %q", got)
+	}
+
+	if got := env.AsMap()["API_TOKEN"]; got != "t" {
+		t.Fatalf("redaction modified the value: %q", got)
+	}
+
+	orig := environ.SecretKeyPatterns
+	defer func() { environ.SecretKeyPatterns = orig }()
+
+	environ.SecretKeyPatterns = []string{"USER", `bad\K`}
+
+	want = "API_TOKEN=t\nAWS_SECRET=s\nDB_PASSWORD_FILE=/run/pw\nKEYBOARD=us\nSSH_KEY=k\nUSER=***"
+	if got := env.String(); got != want {
+		t.Fatalf("unexpected string with custom patterns: %q", got)
+	}
+
+	if err := env.RegisterSecret("KEY.*"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want = "API_TOKEN=t\nAWS_SECRET=s\nDB_PASSWORD_FILE=/run/pw\nKEYBOARD=***\nSSH_KEY=k\nUSER=***"
+	if got := env.String(); got != want {
+		t.Fatalf("unexpected string with a registered secret: %q", got)
+	}
+}
+
+func TestCaseInsensitive(t *testing.T) {
+	env := environ.NewCaseInsensitive([]string{"Path=C:\\Windows", "PATH=C:\\bin", "HOME=C:\\Users\\me"})
+
+	if got := env.Get("path"); got != "C:\\bin" {
+		t.Fatalf("unexpected value for path: %q", got)
+	}
+
+	env.Set("PATH", "C:\\Tools")
+	env.Set("New", "new")
+
+	if !env.Has("new") || !env.Has("PaTh") {
+		t.Fatalf("expected case-insensitive Has")
+	}
+
+	if v, ok := env.GetOK("NEW"); !ok || v != "new" {
+		t.Fatalf("unexpected GetOK result: %q, %v", v, ok)
+	}
+
+	want := []string{"HOME=C:\\Users\\me", "New=new", "Path=C:\\Tools"}
+	if !reflect.DeepEqual(env.AsSlice(), want) {
+		t.Fatalf("unexpected slice: %v", env.AsSlice())
+	}
+
+	env.Unset("home")
+
+	if !reflect.DeepEqual(env.Keys(), []string{"New", "Path"}) {
+		t.Fatalf("unexpected keys: %v", env.Keys())
+	}
+
+	if !env.Clone().Has("path") {
+		t.Fatalf("expected clone to be case-insensitive")
+	}
+
+	if environ.New([]string{"PATH=a"}).Has("path") {
+		t.Fatalf("expected New to be case-sensitive")
+	}
+}
+
+func TestCaseInsensitiveWholeSetWrites(t *testing.T) {
+	env := environ.NewCaseInsensitive(nil)
+
+	if err := env.UnmarshalJSON([]byte(`["PATH=a","Path=b"]`)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !reflect.DeepEqual(env.AsSlice(), []string{"PATH=b"}) {
+		t.Fatalf("unexpected slice after UnmarshalJSON: %v", env.AsSlice())
+	}
+
+	env.Unset("path")
+
+	if env.Len() != 0 || env.Has("PATH") {
+		t.Fatalf("unexpected slice after Unset: %v", env.AsSlice())
+	}
+
+	env.SetAllSlice([]string{"Home=h", "PATH=p"})
+	env.Transform(func(key, value string) (string, string, bool) {
+		if key == "Home" {
+			return "path", value, true
+		}
+
+		return key, value, true
+	})
+
+	if !reflect.DeepEqual(env.AsSlice(), []string{"PATH=h"}) {
+		t.Fatalf("unexpected slice after Transform: %v", env.AsSlice())
+	}
+
+	env.Unset("PATH")
+
+	if env.Has("path") || env.Len() != 0 {
+		t.Fatalf("unexpected slice after Unset: %v", env.AsSlice())
+	}
+}
+
+func TestCaseInsensitiveMerge(t *testing.T) {
+	env := environ.NewCaseInsensitive([]string{"PATH=x", "HOME=h", "TMP=t"})
+
+	env.Merge(environ.New([]string{"path=y", "Home=g"}))
+
+	want := []string{"HOME=g", "PATH=y", "TMP=t"}
+	if !reflect.DeepEqual(env.AsSlice(), want) {
+		t.Fatalf("unexpected slice after Merge: %v", env.AsSlice())
+	}
+
+	env.MergeFunc(environ.New([]string{"tmp=u"}), func(_, existing, _ string) string {
+		return existing
+	})
+
+	if !reflect.DeepEqual(env.AsSlice(), want) {
+		t.Fatalf("unexpected slice after MergeFunc: %v", env.AsSlice())
+	}
+
+	path := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(path, []byte("Tmp=v\n"), 0600); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := env.MergeFile(path); err != nil {
+		t.Fatalf("error in MergeFile(): %v", err)
+	}
+
+	if env.Get("TMP") != "v" || env.Len() != 3 {
+		t.Fatalf("unexpected slice after MergeFile: %v", env.AsSlice())
+	}
+
+	if missing := env.DropLiteral("tmp", "TMP", "none"); !reflect.DeepEqual(missing, []string{"none"}) {
+		t.Fatalf("unexpected missing keys: %v", missing)
+	}
+
+	if missing := env.KeepLiteral("path", "other"); !reflect.DeepEqual(missing, []string{"other"}) {
+		t.Fatalf("unexpected missing keys: %v", missing)
+	}
+
+	if !reflect.DeepEqual(env.AsSlice(), []string{"PATH=y"}) {
+		t.Fatalf("unexpected slice after KeepLiteral: %v", env.AsSlice())
+	}
+
+	env.Set("path", "z")
+
+	if !reflect.DeepEqual(env.AsSlice(), []string{"PATH=z"}) {
+		t.Fatalf("unexpected slice after Set: %v", env.AsSlice())
+	}
+}
+
+func TestEqual(t *testing.T) {
+	a := environ.New([]string{"A=A", "B="})
+
+	if !a.Equal(a) {
+		t.Fatalf("expected an Environ to equal itself")
+	}
+
+	if !a.Equal(environ.New([]string{"B=", "A=A"})) {
+		t.Fatalf("expected Environs with the same contents to be equal")
+	}
+
+	for _, other := range []*environ.Environ{
+		environ.New([]string{"A=A"}),
+		environ.New([]string{"A=A", "B=B"}),
+		environ.New([]string{"A=A", "C="}),
+		environ.New([]string{"A=A", "B=", "C="}),
+	} {
+		if a.Equal(other) || other.Equal(a) {
+			t.Fatalf("expected %v not to equal %v", a.AsSlice(), other.AsSlice())
+		}
+	}
+}
+
+func TestEqualIgnoring(t *testing.T) {
+	a := environ.New([]string{"A=A", "PWD=/a", "SHLVL=1"})
+	b := environ.New([]string{"A=A", "PWD=/b", "OLDPWD=/"})
+
+	if a.EqualIgnoring(b, "PWD") {
+		t.Fatalf("expected SHLVL and OLDPWD to differ")
+	}
+
+	if !a.EqualIgnoring(b, "PWD", "SHLVL", "OLDPWD") {
+		t.Fatalf("expected equality ignoring volatile keys")
+	}
+
+	b.Set("A", "changed")
+	if a.EqualIgnoring(b, "PWD", "SHLVL", "OLDPWD") {
+		t.Fatalf("expected A to differ")
+	}
+
+	if !a.EqualIgnoring(a) {
+		t.Fatalf("expected an Environ to equal itself")
+	}
+}
+
+func TestDiff(t *testing.T) {
+	base := environ.New([]string{"A=A", "B=B", "C=C", "D=D"})
+	env := environ.New([]string{"A=A", "B=Bee", "D=", "E=E", "F=F"})
+
+	added, removed, changed := env.Diff(base)
+
+	if !reflect.DeepEqual(added, []string{"E", "F"}) {
+		t.Fatalf("unexpected added: %v", added)
+	}
+
+	if !reflect.DeepEqual(removed, []string{"C"}) {
+		t.Fatalf("unexpected removed: %v", removed)
+	}
+
+	if !reflect.DeepEqual(changed, []string{"B", "D"}) {
+		t.Fatalf("unexpected changed: %v", changed)
+	}
+
+	added, removed, changed = env.Diff(env)
+	if len(added)+len(removed)+len(changed) != 0 {
+		t.Fatalf("expected no differences with itself: %v, %v, %v", added, removed, changed)
+	}
+}
+
+func TestDeltaTo(t *testing.T) {
+	env := environ.New([]string{"A=A", "B=B", "C=C", "D=D"})
+	target := environ.New([]string{"A=A", "B=Bee", "D=", "E=E"})
+
+	set, unset := env.DeltaTo(target)
+
+	if !reflect.DeepEqual(set, map[string]string{"B": "Bee", "D": "", "E": "E"}) {
+		t.Fatalf("unexpected set: %v", set)
+	}
+
+	if !reflect.DeepEqual(unset, []string{"C"}) {
+		t.Fatalf("unexpected unset: %v", unset)
+	}
+
+	env.SetAll(set)
+	env.UnsetAll(unset...)
+
+	if !env.Equal(target) {
+		t.Fatalf("applying the delta didn't reach the target: %v", env.AsSlice())
+	}
+
+	set, unset = env.DeltaTo(env)
+	if len(set)+len(unset) != 0 {
+		t.Fatalf("expected no delta to itself: %v, %v", set, unset)
+	}
+}
+
+func TestClear(t *testing.T) {
+	env := environ.New([]string{"A=A", "B=B"})
+
+	env.Clear()
+
+	if env.Len() != 0 {
+		t.Fatalf("expected an empty environ: %v", env.AsSlice())
+	}
+
+	env.Set("C", "C")
+
+	if !reflect.DeepEqual(env.AsSlice(), []string{"C=C"}) {
+		t.Fatalf("unexpected slice: %v", env.AsSlice())
+	}
+}
+
+func TestSetIfAbsent(t *testing.T) {
+	env := environ.New([]string{"A=A", "B="})
+
+	if env.SetIfAbsent("A", "Apple") {
+		t.Fatalf("expected A not to be set")
+	}
+
+	if env.SetIfAbsent("B", "Bee") {
+		t.Fatalf("expected empty B not to be set")
+	}
+
+	if !env.SetIfAbsent("C", "C") {
+		t.Fatalf("expected C to be set")
+	}
+
+	if !reflect.DeepEqual(env.AsSlice(), []string{"A=A", "B=", "C=C"}) {
+		t.Fatalf("unexpected slice: %v", env.AsSlice())
+	}
+}
+
+func TestSetAll(t *testing.T) {
+	env := environ.New([]string{"A=A", "B=B"})
+
+	env.SetAll(map[string]string{"B": "Bee", "C": "C"})
+
+	if !reflect.DeepEqual(env.AsSlice(), []string{"A=A", "B=Bee", "C=C"}) {
+		t.Fatalf("unexpected slice: %v", env.AsSlice())
+	}
+
+	env.SetAllSlice([]string{"# comment", "A=Apple", "NOEQUALS", "D=D=D"})
+
+	if !reflect.DeepEqual(env.AsSlice(), []string{"A=Apple", "B=Bee", "C=C", "D=D=D"}) {
+		t.Fatalf("unexpected slice: %v", env.AsSlice())
+	}
+}
+
+func TestUnsetAll(t *testing.T) {
+	env := environ.New([]string{"A=A", "B=B", "C=C"})
+
+	if n := env.UnsetAll("A", "MISSING", "C", "A"); n != 2 {
+		t.Fatalf("expected 2 keys removed, got %d", n)
+	}
+
+	if !reflect.DeepEqual(env.AsSlice(), []string{"B=B"}) {
+		t.Fatalf("unexpected slice: %v", env.AsSlice())
+	}
+
+	if n := env.UnsetAll(); n != 0 {
+		t.Fatalf("expected no keys removed, got %d", n)
+	}
+}
+
+func TestRename(t *testing.T) {
+	env := environ.New([]string{"OLD_NAME=value", "OTHER=other", "A=A"})
+
+	if !env.Rename("OLD_NAME", "NEW_NAME") {
+		t.Fatalf("expected OLD_NAME to be renamed")
+	}
+
+	if !env.Rename("OTHER", "A") {
+		t.Fatalf("expected OTHER to be renamed")
+	}
+
+	if env.Rename("MISSING", "A") {
+		t.Fatalf("expected MISSING not to be renamed")
+	}
+
+	if !reflect.DeepEqual(env.AsSlice(), []string{"A=other", "NEW_NAME=value"}) {
+		t.Fatalf("unexpected slice: %v", env.AsSlice())
+	}
+}
+
+func TestSubset(t *testing.T) {
+	env := environ.New([]string{"A=A", "B=B", "A_A=AA", "A_B=AB"})
+
+	sub, missing, err := env.Subset("A_.*", "C")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !reflect.DeepEqual(sub.AsSlice(), []string{"A_A=AA", "A_B=AB"}) {
+		t.Fatalf("unexpected subset: %v", sub.AsSlice())
+	}
+
+	if !reflect.DeepEqual(missing, []string{"C"}) {
+		t.Fatalf("unexpected missing: %v", missing)
+	}
+
+	if env.Len() != 4 {
+		t.Fatalf("environ was modified: %v", env.AsSlice())
+	}
+
+	if _, _, err = env.Subset(`unsupported\K`); err == nil {
+		t.Fatalf("expected an error which did not occur")
+	}
+}
+
+func TestPrefix(t *testing.T) {
+	env := environ.New([]string{"APP_PORT=80", "APP_HOST=localhost", "APP_=empty", "HOME=/home/me", "XAPP_A=x"})
+
+	if !reflect.DeepEqual(env.WithPrefix("APP_").AsSlice(), []string{"APP_=empty", "APP_HOST=localhost", "APP_PORT=80"}) {
+		t.Fatalf("unexpected WithPrefix: %v", env.WithPrefix("APP_").AsSlice())
+	}
+
+	if !reflect.DeepEqual(env.StripPrefix("APP_").AsSlice(), []string{"HOST=localhost", "PORT=80"}) {
+		t.Fatalf("unexpected StripPrefix: %v", env.StripPrefix("APP_").AsSlice())
+	}
+
+	if env.Len() != 5 {
+		t.Fatalf("environ was modified: %v", env.AsSlice())
+	}
+}
+
+func TestLenTracksMutations(t *testing.T) {
+	env := environ.New([]string{"A=A", "B=B", "C=C"})
+
+	steps := []struct {
+		name string
+		fn   func()
+		want int
+	}{
+		{name: "Set new", fn: func() { env.Set("D", "D") }, want: 4},
+		{name: "Set existing", fn: func() { env.Set("A", "Apple") }, want: 4},
+		{name: "Unset", fn: func() { env.Unset("D") }, want: 3},
+		{name: "Unset missing", fn: func() { env.Unset("D") }, want: 3},
+		{name: "Keep", fn: func() { _, _ = env.Keep("A", "B") }, want: 2},
+		{name: "Drop", fn: func() { _, _ = env.Drop("A") }, want: 1},
+		{name: "Clear", fn: func() { env.Clear() }, want: 0},
+	}
+
+	for _, step := range steps {
+		step.fn()
+		if got := env.Len(); got != step.want {
+			t.Fatalf("after %s: expected Len %d, got %d", step.name, step.want, got)
+		}
+	}
+}
+
+func TestLenConcurrent(t *testing.T) {
+	env := environ.New(nil)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			for j := 0; j < 100; j++ {
+				key := string(rune('A'+i)) + strings.Repeat("_", j)
+				env.Set(key, "v")
+				_ = env.Len()
+			}
+		}(i)
+	}
+
+	wg.Wait()
+
+	if env.Len() != 800 || len(env.Keys()) != 800 {
+		t.Fatalf("expected 800 entries, Len %d, Keys %d", env.Len(), len(env.Keys()))
+	}
+}
+
+func TestGetDefault(t *testing.T) {
+	env := environ.New([]string{"A=A", "B="})
+
+	if got := env.GetDefault("A", "fallback"); got != "A" {
+		t.Fatalf("unexpected value for A: %q", got)
+	}
+
+	if got := env.GetDefault("B", "fallback"); got != "" {
+		t.Fatalf("unexpected value for B: %q", got)
+	}
+
+	if got := env.GetDefault("C", "fallback"); got != "fallback" {
+		t.Fatalf("unexpected value for C: %q", got)
+	}
+}
+
+// TestUnmarshalJSONConcurrent unmarshals into an Environ in use by other
+// goroutines, and is most useful under go test -race.
+func TestUnmarshalJSONConcurrent(t *testing.T) {
+	env := environ.New([]string{"A=A"})
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+
+	go func() {
+		defer wg.Done()
+
+		for i := 0; i < 200; i++ {
+			if err := env.UnmarshalJSON([]byte(fmt.Sprintf(`["A=%d", "B=B"]`, i))); err != nil {
+				t.Errorf("unexpected error: %v", err)
+
+				return
+			}
+		}
+	}()
+
+	go func() {
+		defer wg.Done()
+
+		for i := 0; i < 200; i++ {
+			_ = env.Get("A")
+			_ = env.AsSlice()
+			env.Set("C", "C")
+		}
+	}()
+
+	wg.Wait()
+
+	if env.Get("A") != "199" || env.Get("B") != "B" {
+		t.Fatalf("unexpected environ: %v", env.AsSlice())
+	}
+}
+
+func TestUnmarshalJSONKeepsSettings(t *testing.T) {
+	env := environ.NewCaseInsensitive(nil)
+	if err := env.UnmarshalJSON([]byte(`["Path=/bin"]`)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if env.Get("PATH") != "/bin" {
+		t.Fatalf("expected lookups to stay case-insensitive: %v", env.AsSlice())
+	}
+
+	frozen := env.Freeze()
+
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("expected unmarshaling into a frozen Environ to panic")
+		}
+	}()
+
+	_ = frozen.UnmarshalJSON([]byte(`["A=A"]`))
+}
+
+func TestMergeJSON(t *testing.T) {
+	env := environ.New([]string{"A=A", "B=B"})
+
+	if err := env.MergeJSON([]byte(`["B=Bee", "C=C"]`)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := env.MergeJSON([]byte(`{"C": "Sea", "D": "D"}`)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !reflect.DeepEqual(env.AsSlice(), []string{"A=A", "B=Bee", "C=Sea", "D=D"}) {
+		t.Fatalf("unexpected slice: %v", env.AsSlice())
+	}
+
+	if err := env.MergeJSON([]byte(`{"E": 1}`)); err == nil {
+		t.Fatalf("expected an error which did not occur")
+	}
+
+	if env.Len() != 4 {
+		t.Fatalf("environ was modified by a failed merge: %v", env.AsSlice())
+	}
+}
+
+func TestUnmarshalJSONObject(t *testing.T) {
+	env := new(environ.Environ)
+	if err := env.UnmarshalJSON([]byte(` {"B": "B", "A": "A=A", "C": ""}`)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !reflect.DeepEqual(env.AsSlice(), []string{"A=A=A", "B=B", "C="}) {
+		t.Fatalf("unexpected slice: %v", env.AsSlice())
+	}
+
+	for _, data := range []string{`{"A": 1}`, `{"A": "A", "B": null}`, `{"A": ["A"]}`} {
+		err := env.UnmarshalJSON([]byte(data))
+		if err == nil || !strings.Contains(err.Error(), "not a string") {
+			t.Fatalf("expected a non-string error for %s, got: %v", data, err)
+		}
+	}
+}
+
+func TestMarshalJSONObject(t *testing.T) {
+	orig := environ.New([]string{"B=B", "A=A=A", "C="})
+
+	marshaled, err := orig.MarshalJSONObject()
+	if err != nil {
+		t.Fatalf("error in MarshalJSONObject(): %v", err)
+	}
+
+	if string(marshaled) != `{"A":"A=A","B":"B","C":""}` {
+		t.Fatalf("unexpected JSON: %s", marshaled)
+	}
+
+	unmarshaled := new(environ.Environ)
+	if err = unmarshaled.UnmarshalJSON(marshaled); err != nil {
+		t.Fatalf("error in UnmarshalJSON(): %v", err)
+	}
+
+	if !reflect.DeepEqual(orig.AsSlice(), unmarshaled.AsSlice()) {
+		t.Fatalf("expected orig to match unmarshaled, orig: %v, unmarshaled: %v", orig.AsSlice(), unmarshaled.AsSlice())
+	}
+}
+
+func TestMatchKeys(t *testing.T) {
+	env := environ.New([]string{"A=A", "A_B=AB", "B_A=BA", "A_A=AA"})
+
+	matched, err := env.MatchKeys("A_.*")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !reflect.DeepEqual(matched, []string{"A_A", "A_B"}) {
+		t.Fatalf("unexpected keys: %v", matched)
+	}
+
+	if env.Len() != 4 {
+		t.Fatalf("environ was modified: %v", env.AsSlice())
+	}
+
+	if _, err = env.MatchKeys(`unsupported\K`); err == nil {
+		t.Fatalf("expected an error which did not occur")
+	}
+}
+
+func TestGetMatching(t *testing.T) {
+	env := environ.New([]string{"A=A", "A_B=AB", "B_A=BA", "A_A=AA"})
+
+	matched, err := env.GetMatching("A_.*")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !reflect.DeepEqual(matched, map[string]string{"A_A": "AA", "A_B": "AB"}) {
+		t.Fatalf("unexpected map: %v", matched)
+	}
+
+	matched["A"] = "modified"
+	if v := env.Get("A"); v != "A" {
+		t.Fatalf("environ was modified: %v", env.AsSlice())
+	}
+
+	if _, err = env.GetMatching(`unsupported\K`); err == nil {
+		t.Fatalf("expected an error which did not occur")
+	}
+}
+
+func TestSearchValues(t *testing.T) {
+	env := environ.New([]string{
+		"PATH=/usr/bin:/opt/tool/bin",
+		"TOOL_HOME=/opt/tool",
+		"HOME=/home/user",
+		"EMPTY=",
+	})
+
+	matched, err := env.SearchValues("/opt/tool")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !reflect.DeepEqual(matched, []string{"PATH", "TOOL_HOME"}) {
+		t.Fatalf("unexpected keys: %v", matched)
+	}
+
+	if matched, _ = env.SearchValues("^$"); !reflect.DeepEqual(matched, []string{"EMPTY"}) {
+		t.Fatalf("unexpected keys: %v", matched)
+	}
+
+	if _, err = env.SearchValues(`unsupported\K`); err == nil {
+		t.Fatalf("expected an error which did not occur")
+	}
+}
+
+// TestConcurrentAccess exercises mixed reads and writes from many
+// goroutines, and is most useful under go test -race.
+func TestConcurrentAccess(t *testing.T) {
+	env := environ.New([]string{"KEEP_A=A", "KEEP_B=B", "DROP_A=A"})
+
+	const workers, iterations = 16, 200
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+
+			for i := 0; i < iterations; i++ {
+				key := fmt.Sprintf("KEEP_%d_%d", w, i)
+				switch i % 8 {
+				case 0:
+					env.Set(key, "v")
+				case 1:
+					_ = env.Get(key)
+				case 2:
+					_, _ = env.Keep("KEEP_.*")
+				case 3:
+					_, _ = env.Drop("DROP_.*")
+				case 4:
+					_ = env.AsSlice()
+				case 5:
+					_, _ = env.MarshalJSON()
+				case 6:
+					env.Unset(key)
+				case 7:
+					_ = env.Len()
+					_ = env.Keys()
+				}
+			}
+		}(w)
+	}
+
+	wg.Wait()
+
+	for _, k := range env.Keys() {
+		if !strings.HasPrefix(k, "KEEP_") {
+			t.Fatalf("unexpected key survived: %s", k)
+		}
+	}
+
+	if env.Len() != len(env.Keys()) {
+		t.Fatalf("Len %d out of step with Keys %d", env.Len(), len(env.Keys()))
+	}
+}
+
+// TestKeepDoesNotLoseConcurrentSet guards against Keep and Drop working on
+// a stale copy of the map and overwriting Sets made in the meantime.
+func TestKeepDoesNotLoseConcurrentSet(t *testing.T) {
+	env := environ.New([]string{"KEEP_0=0", "DROP_0=0"})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		for i := 1; i <= 500; i++ {
+			env.Set(fmt.Sprintf("KEEP_%d", i), "v")
+		}
+	}()
+
+	for running := true; running; {
+		select {
+		case <-done:
+			running = false
+		default:
+			_, _ = env.Keep("KEEP_.*")
+			_, _ = env.Drop("DROP_.*")
+		}
+	}
+
+	for i := 0; i <= 500; i++ {
+		if key := fmt.Sprintf("KEEP_%d", i); !env.Has(key) {
+			t.Fatalf("set of %s was lost", key)
+		}
+	}
+}
+
+func TestCountMatching(t *testing.T) {
+	env := environ.New([]string{"A=A", "A_B=AB", "B_A=BA", "A_A=AA"})
+
+	n, err := env.CountMatching("A_.*")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if n != 2 {
+		t.Fatalf("expected 2 matches, got %d", n)
+	}
+
+	if _, err = env.CountMatching(`unsupported\K`); err == nil {
+		t.Fatalf("expected an error which did not occur")
+	}
+}
+
+func TestDropEmpty(t *testing.T) {
+	env := environ.New([]string{"A=A", "C=", "B=", "D= "})
+
+	dropped := env.DropEmpty()
+
+	if !reflect.DeepEqual(dropped, []string{"B", "C"}) {
+		t.Fatalf("unexpected dropped: %v", dropped)
+	}
+
+	if !reflect.DeepEqual(env.AsSlice(), []string{"A=A", "D= "}) {
+		t.Fatalf("unexpected slice: %v", env.AsSlice())
+	}
+}
+
+func TestTransform(t *testing.T) {
+	env := environ.New([]string{"path= /bin ", "PATH=/usr/bin", "home=/home/me", "DROP=me"})
+
+	env.Transform(func(key, value string) (string, string, bool) {
+		return strings.ToUpper(key), strings.TrimSpace(value), key != "DROP"
+	})
+
+	// "path" sorts after "PATH", so its value wins the collision.
+	if !reflect.DeepEqual(env.AsSlice(), []string{"HOME=/home/me", "PATH=/bin"}) {
+		t.Fatalf("unexpected slice: %v", env.AsSlice())
+	}
+}
+
+func TestNormalizeKeys(t *testing.T) {
+	env := environ.New([]string{"PATH=upper", "Path=mixed", "path=lower", "Home=h"})
+
+	env.UpperKeys()
+
+	if !reflect.DeepEqual(env.AsSlice(), []string{"HOME=h", "PATH=lower"}) {
+		t.Fatalf("unexpected slice: %v", env.AsSlice())
+	}
+
+	env.LowerKeys()
+
+	if !reflect.DeepEqual(env.AsSlice(), []string{"home=h", "path=lower"}) {
+		t.Fatalf("unexpected slice: %v", env.AsSlice())
+	}
+
+	env.NormalizeKeys(func(k string) string { return "APP_" + k })
+
+	if !reflect.DeepEqual(env.Keys(), []string{"APP_home", "APP_path"}) {
+		t.Fatalf("unexpected keys: %v", env.Keys())
+	}
+}
+
+func TestMergeOS(t *testing.T) {
+	restoreOSEnv(t)
+
+	if err := environ.New([]string{"ENVIRON_TEST_A=os", "ENVIRON_TEST_B=os"}).ApplyToOSExclusive(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	env := environ.New([]string{"ENVIRON_TEST_A=mine", "ENVIRON_TEST_C=mine"})
+	env.MergeOS()
+
+	want := []string{"ENVIRON_TEST_A=mine", "ENVIRON_TEST_B=os", "ENVIRON_TEST_C=mine"}
+	if !reflect.DeepEqual(env.AsSlice(), want) {
+		t.Fatalf("unexpected slice after MergeOS: %v", env.AsSlice())
+	}
+
+	env.OverrideWithOS()
+
+	want = []string{"ENVIRON_TEST_A=os", "ENVIRON_TEST_B=os", "ENVIRON_TEST_C=mine"}
+	if !reflect.DeepEqual(env.AsSlice(), want) {
+		t.Fatalf("unexpected slice after OverrideWithOS: %v", env.AsSlice())
+	}
+}
+
+func TestIntersect(t *testing.T) {
+	a := environ.New([]string{"A=A", "B=B", "C=C", "D="})
+	b := environ.New([]string{"A=A", "B=Bee", "D=", "E=E"})
+
+	if got := a.Intersect(b); !reflect.DeepEqual(got.AsSlice(), []string{"A=A", "D="}) {
+		t.Fatalf("unexpected intersection: %v", got.AsSlice())
+	}
+
+	if got := b.Intersect(a); !reflect.DeepEqual(got.AsSlice(), []string{"A=A", "D="}) {
+		t.Fatalf("unexpected intersection: %v", got.AsSlice())
+	}
+
+	if got := a.Intersect(a); !got.Equal(a) {
+		t.Fatalf("unexpected self intersection: %v", got.AsSlice())
+	}
+}
+
+func TestKeepDropRegexp(t *testing.T) {
+	env := environ.New([]string{"AWS_REGION=r", "AWS_KEY=k", "MY_AWS=m", "HOME=h", "GOPATH=p"})
+
+	missing := env.KeepRegexp(regexp.MustCompile("AWS"), regexp.MustCompile("^GO"), regexp.MustCompile("^AZURE_"))
+
+	if !reflect.DeepEqual(env.AsSlice(), []string{"AWS_KEY=k", "AWS_REGION=r", "GOPATH=p", "MY_AWS=m"}) {
+		t.Fatalf("didn't keep correct values: %v", env.AsSlice())
+	}
+
+	if !reflect.DeepEqual(missing, []string{"^AZURE_"}) {
+		t.Fatalf("unexpected missing: %v", missing)
+	}
+
+	missing = env.DropRegexp(regexp.MustCompile("^AWS_"), regexp.MustCompile("HOME"))
+
+	if !reflect.DeepEqual(env.AsSlice(), []string{"GOPATH=p", "MY_AWS=m"}) {
+		t.Fatalf("didn't drop correct values: %v", env.AsSlice())
+	}
+
+	if !reflect.DeepEqual(missing, []string{"HOME"}) {
+		t.Fatalf("unexpected missing: %v", missing)
+	}
+}
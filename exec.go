@@ -0,0 +1,21 @@
+package environ
+
+import (
+	"context"
+	"os/exec"
+)
+
+// SetCmdEnv sets cmd's environment to the contents of the Environ,
+// replacing whatever cmd.Env held before.
+func (e *Environ) SetCmdEnv(cmd *exec.Cmd) {
+	cmd.Env = e.AsSlice()
+}
+
+// CommandContext behaves like exec.CommandContext, with the returned Cmd's
+// environment set to the contents of env.
+func CommandContext(ctx context.Context, env *Environ, name string, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, name, args...)
+	env.SetCmdEnv(cmd)
+
+	return cmd
+}
@@ -0,0 +1,36 @@
+package environ_test
+
+import (
+	"context"
+	"os/exec"
+	"reflect"
+	"testing"
+
+	"github.com/metrumresearchgroup/environ"
+)
+
+func TestSetCmdEnv(t *testing.T) {
+	env := environ.New([]string{"B=B", "A=A"})
+
+	cmd := exec.Command("true")
+	cmd.Env = []string{"C=C"}
+	env.SetCmdEnv(cmd)
+
+	if !reflect.DeepEqual(cmd.Env, []string{"A=A", "B=B"}) {
+		t.Fatalf("unexpected cmd env: %v", cmd.Env)
+	}
+}
+
+func TestCommandContext(t *testing.T) {
+	env := environ.New([]string{"A=A"})
+
+	cmd := environ.CommandContext(context.Background(), env, "echo", "hello")
+
+	if !reflect.DeepEqual(cmd.Env, []string{"A=A"}) {
+		t.Fatalf("unexpected cmd env: %v", cmd.Env)
+	}
+
+	if !reflect.DeepEqual(cmd.Args, []string{"echo", "hello"}) {
+		t.Fatalf("unexpected cmd args: %v", cmd.Args)
+	}
+}
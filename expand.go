@@ -0,0 +1,157 @@
+package environ
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Expand replaces $VAR and ${VAR} references in s with values from the
+// Environ, in the manner of os.Expand. References to keys which are not
+// present are replaced by the empty string.
+func (e *Environ) Expand(s string) string {
+	defer e.readLocker()()
+
+	return expand(e.view(), s)
+}
+
+// ExpandSlice returns a new slice holding each of args expanded as by
+// Expand, such as the arguments of a command to be run with the Environ.
+func (e *Environ) ExpandSlice(args []string) []string {
+	defer e.readLocker()()
+
+	m := e.view()
+
+	expanded := make([]string, len(args))
+	for i, arg := range args {
+		expanded[i] = expand(m, arg)
+	}
+
+	return expanded
+}
+
+// GetExpanded retrieves the value under key with its $VAR and ${VAR}
+// references expanded against the Environ, as by Expand.
+//
+// Expansion is a single pass: if a referenced value itself contains
+// references, they're returned unexpanded. Use ExpandAll or Flatten to
+// resolve further.
+func (e *Environ) GetExpanded(key string) string {
+	defer e.readLocker()()
+
+	v, _ := e.get(e.lookup(key))
+
+	return expand(e.view(), v)
+}
+
+// Lookup retrieves the value under key with its references expanded, as by
+// GetExpanded, or returns fallback unchanged if key is missing. A key
+// holding the empty string is present, so its value is returned.
+func (e *Environ) Lookup(key, fallback string) string {
+	defer e.readLocker()()
+
+	v, ok := e.get(e.lookup(key))
+	if !ok {
+		return fallback
+	}
+
+	return expand(e.view(), v)
+}
+
+// ExpandAll expands the references in every value of the Environ, using
+// the values as they were before the call.
+//
+// Expansion is a single pass over a snapshot, so the result doesn't depend
+// on the order keys are visited in. Self-referential and cyclic references
+// are resolved once against the previous values and never loop: for
+// example "PATH=$HOME/bin:$PATH" becomes the old PATH prefixed by
+// "$HOME/bin", and any "$VAR" left in the result is not expanded again.
+func (e *Environ) ExpandAll() {
+	defer e.writeLocker()()
+
+	e.rewrite()
+	snapshot := copyMap(e.m)
+	for k, v := range snapshot {
+		e.m[k] = expand(snapshot, v)
+	}
+}
+
+func expand(m map[string]string, s string) string {
+	return os.Expand(s, func(key string) string {
+		return m[key]
+	})
+}
+
+// ErrCyclicReference is wrapped by the error Flatten returns when values
+// refer to each other in a cycle.
+var ErrCyclicReference = errors.New("cyclic reference")
+
+// Flatten returns a new Environ in which every $VAR and ${VAR} reference
+// has been fully resolved against the rest of the set, so the values can
+// be handed to a process that doesn't interpolate, such as one started by
+// os/exec. References to missing keys become the empty string, as with
+// Expand. The Environ itself is unchanged.
+//
+// Unlike ExpandAll, references are followed through as many levels as
+// needed, so values that refer to each other in a cycle, including a value
+// referring to itself such as "PATH=$PATH:/bin", produce an error wrapping
+// ErrCyclicReference that describes the cycle.
+func (e *Environ) Flatten() (*Environ, error) {
+	src := e.AsMap()
+	resolved := make(map[string]string, len(src))
+
+	var stack []string
+	visiting := make(map[string]bool)
+
+	var resolve func(key string) error
+	resolve = func(key string) error {
+		if _, ok := resolved[key]; ok {
+			return nil
+		}
+
+		v, ok := src[key]
+		if !ok {
+			return nil
+		}
+
+		if visiting[key] {
+			for i, k := range stack {
+				if k == key {
+					cycle := append(stack[i:len(stack):len(stack)], key)
+
+					return fmt.Errorf("%s: %w", strings.Join(cycle, " -> "), ErrCyclicReference)
+				}
+			}
+		}
+
+		visiting[key] = true
+		stack = append(stack, key)
+
+		var err error
+		flat := os.Expand(v, func(ref string) string {
+			if err == nil {
+				err = resolve(ref)
+			}
+
+			return resolved[ref]
+		})
+		if err != nil {
+			return err
+		}
+
+		stack = stack[:len(stack)-1]
+		visiting[key] = false
+		resolved[key] = flat
+
+		return nil
+	}
+
+	for _, k := range keys(src) {
+		if err := resolve(k); err != nil {
+			return nil, err
+		}
+	}
+
+	return e.derive(resolved), nil
+}
@@ -0,0 +1,132 @@
+package environ_test
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/metrumresearchgroup/environ"
+)
+
+func TestExpand(t *testing.T) {
+	env := environ.New([]string{"HOME=/home/me", "EMPTY="})
+
+	got := env.Expand("$HOME/bin:${HOME}/go/bin:$EMPTY$MISSING")
+	if got != "/home/me/bin:/home/me/go/bin:" {
+		t.Fatalf("unexpected expansion: %q", got)
+	}
+}
+
+func TestExpandSlice(t *testing.T) {
+	env := environ.New([]string{"HOME=/home/me"})
+
+	args := []string{"--home", "$HOME", "${HOME}/.config", "$MISSING"}
+
+	got := env.ExpandSlice(args)
+	if !reflect.DeepEqual(got, []string{"--home", "/home/me", "/home/me/.config", ""}) {
+		t.Fatalf("unexpected expansion: %q", got)
+	}
+
+	if args[1] != "$HOME" {
+		t.Fatalf("caller's slice was modified: %q", args)
+	}
+}
+
+func TestExpandAll(t *testing.T) {
+	env := environ.New([]string{
+		"HOME=/home/me",
+		"PATH=$HOME/bin:$PATH",
+		"A=$B",
+		"B=$A",
+		"C=${MISSING}c",
+	})
+
+	env.ExpandAll()
+
+	want := []string{"A=$A", "B=$B", "C=c", "HOME=/home/me", "PATH=/home/me/bin:$HOME/bin:$PATH"}
+	if !reflect.DeepEqual(env.AsSlice(), want) {
+		t.Fatalf("unexpected slice: %v", env.AsSlice())
+	}
+}
+
+func TestGetExpanded(t *testing.T) {
+	env := environ.New([]string{"HOME=/home/me", "BIN=$HOME/bin", "PATH=$BIN:${MISSING}/usr/bin"})
+
+	if got := env.GetExpanded("BIN"); got != "/home/me/bin" {
+		t.Fatalf("unexpected BIN: %q", got)
+	}
+
+	if got := env.GetExpanded("PATH"); got != "$HOME/bin:/usr/bin" {
+		t.Fatalf("unexpected PATH: %q", got)
+	}
+
+	if got := env.GetExpanded("NOPE"); got != "" {
+		t.Fatalf("unexpected NOPE: %q", got)
+	}
+}
+
+func TestLookup(t *testing.T) {
+	env := environ.New([]string{"HOME=/home/me", "CONFIG=${HOME}/.config", "EMPTY="})
+
+	if got := env.Lookup("CONFIG", "/etc"); got != "/home/me/.config" {
+		t.Fatalf("unexpected value: %q", got)
+	}
+
+	if got := env.Lookup("MISSING", "$HOME/default"); got != "$HOME/default" {
+		t.Fatalf("expected the fallback unexpanded, got %q", got)
+	}
+
+	if got := env.Lookup("EMPTY", "fallback"); got != "" {
+		t.Fatalf("expected the empty value, got %q", got)
+	}
+}
+
+func TestFlatten(t *testing.T) {
+	env := environ.New([]string{
+		"HOME=/home/me",
+		"GOPATH=$HOME/go",
+		"GOBIN=${GOPATH}/bin",
+		"PATH=$GOBIN:$MISSING/usr/bin",
+		"LITERAL=plain",
+	})
+
+	flat, err := env.Flatten()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []string{
+		"GOBIN=/home/me/go/bin",
+		"GOPATH=/home/me/go",
+		"HOME=/home/me",
+		"LITERAL=plain",
+		"PATH=/home/me/go/bin:/usr/bin",
+	}
+	if !reflect.DeepEqual(flat.AsSlice(), want) {
+		t.Fatalf("unexpected slice: %v", flat.AsSlice())
+	}
+
+	if env.Get("PATH") != "$GOBIN:$MISSING/usr/bin" {
+		t.Fatalf("environ was modified: %v", env.AsSlice())
+	}
+}
+
+func TestFlattenCycles(t *testing.T) {
+	for _, tc := range []struct {
+		env   []string
+		cycle string
+	}{
+		{env: []string{"PATH=$PATH:/bin"}, cycle: "PATH -> PATH"},
+		{env: []string{"A=$B", "B=${C}", "C=x$A", "D=$A"}, cycle: "A -> B -> C -> A"},
+	} {
+		_, err := environ.New(tc.env).Flatten()
+		if !errors.Is(err, environ.ErrCyclicReference) {
+			t.Fatalf("expected ErrCyclicReference for %v, got: %v", tc.env, err)
+		}
+
+		if !strings.Contains(err.Error(), tc.cycle) {
+			t.Fatalf("expected error to describe %q, got: %v", tc.cycle, err)
+		}
+	}
+}
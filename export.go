@@ -0,0 +1,70 @@
+package environ
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ExportScript returns a shell script which sets the Environ's variables
+// when sourced, with one line per variable in lexical key order:
+//
+//	export KEY='value'
+//
+// Values are single-quoted, so spaces and shell metacharacters are
+// preserved literally, and any embedded single quote is written as a
+// closing quote, an escaped quote and an opening quote.
+//
+// Keys can't be quoted, so those which fail ValidKey, such as "$(id)",
+// are left out rather than written where the shell would run them.
+func (e *Environ) ExportScript() string {
+	defer e.readLocker()()
+
+	m := e.view()
+
+	var b strings.Builder
+	for _, k := range keys(m) {
+		if !ValidKey(k) {
+			continue
+		}
+
+		b.WriteString("export " + k + "=" + shellQuote(m[k]) + "\n")
+	}
+
+	return b.String()
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// WriteDockerEnvFile writes the Environ to w in the format of docker run's
+// --env-file: one unquoted KEY=VALUE line per variable, in lexical key
+// order.
+//
+// Docker applies no quoting or interpolation, so every entry is checked
+// before anything is written: keys must be non-empty and free of "=" and
+// whitespace, and values must not contain line breaks. Otherwise an error
+// listing every offending key is returned and nothing is written.
+func (e *Environ) WriteDockerEnvFile(w io.Writer) error {
+	m := e.AsMap()
+
+	var invalid []string
+	for _, k := range keys(m) {
+		if k == "" || strings.ContainsAny(k, "= \t\r\n") || strings.ContainsAny(m[k], "\r\n") {
+			invalid = append(invalid, fmt.Sprintf("%q", k))
+		}
+	}
+
+	if len(invalid) > 0 {
+		return fmt.Errorf("docker env file: invalid entries for keys %s", strings.Join(invalid, ", "))
+	}
+
+	for _, line := range envMapAsSlice(m) {
+		if _, err := io.WriteString(w, line+"\n"); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,88 @@
+package environ_test
+
+import (
+	"bytes"
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/metrumresearchgroup/environ"
+)
+
+func TestExportScript(t *testing.T) {
+	env := environ.New([]string{"B=it's $HOME", "A=two words", "C="})
+
+	want := "export A='two words'\nexport B='it'\\''s $HOME'\nexport C=''\n"
+	if got := env.ExportScript(); got != want {
+		t.Fatalf("unexpected script:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestExportScriptInvalidKeys(t *testing.T) {
+	env := environ.New([]string{"$(id)=1", "A B=2", "1A=3", "=4", "OK=5"})
+
+	if got := env.ExportScript(); got != "export OK='5'\n" {
+		t.Fatalf("unexpected script: %q", got)
+	}
+}
+
+func TestExportScriptSourced(t *testing.T) {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("no sh available")
+	}
+
+	env := environ.New([]string{"A=it's \"$HOME\" `x` \\ done", "B=line\nbreak"})
+
+	cmd := exec.Command(sh, "-c", env.ExportScript()+`printf '%s\0%s' "$A" "$B"`)
+	cmd.Env = []string{}
+
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("running script: %v", err)
+	}
+
+	if got := strings.Split(string(out), "\x00"); !reflect.DeepEqual(got, []string{env.Get("A"), env.Get("B")}) {
+		t.Fatalf("unexpected values after sourcing: %q", got)
+	}
+}
+
+func TestWriteDockerEnvFile(t *testing.T) {
+	env := environ.New([]string{"B=has spaces and 'quotes'", "A=a=b", "C="})
+
+	var buf bytes.Buffer
+	if err := env.WriteDockerEnvFile(&buf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if buf.String() != "A=a=b\nB=has spaces and 'quotes'\nC=\n" {
+		t.Fatalf("unexpected output: %q", buf.String())
+	}
+}
+
+func TestWriteDockerEnvFileInvalid(t *testing.T) {
+	env := environ.New([]string{"GOOD=good", "MY VAR=x"})
+	env.Set("A=B", "x")
+	env.Set("MULTI", "line\nbreak")
+
+	var buf bytes.Buffer
+	err := env.WriteDockerEnvFile(&buf)
+	if err == nil {
+		t.Fatalf("expected an error which did not occur")
+	}
+
+	for _, key := range []string{`"A=B"`, `"MULTI"`, `"MY VAR"`} {
+		if !strings.Contains(err.Error(), key) {
+			t.Fatalf("expected error to name %s: %v", key, err)
+		}
+	}
+
+	if strings.Contains(err.Error(), "GOOD") {
+		t.Fatalf("expected error not to name GOOD: %v", err)
+	}
+
+	if buf.Len() != 0 {
+		t.Fatalf("expected nothing to be written, got: %q", buf.String())
+	}
+}
@@ -0,0 +1,203 @@
+package environ
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// LoadFile reads a .env style file from path and returns an Environ
+// containing its values.
+//
+// Lines may end in either "\n" or "\r\n". Each line is parsed with the same
+// rules as New: comments, blank lines and lines without an "=" are skipped,
+// and keys and values are taken verbatim, without trimming whitespace.
+func LoadFile(path string) (*Environ, error) {
+	lines, err := readLines(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return New(lines), nil
+}
+
+// MaxLineSize is the longest line, in bytes, that NewFromReader and
+// NewDotenvFromReader will accept.
+const MaxLineSize = 4 << 20
+
+// NewFromReader creates an Environ from "key=value" lines read from r,
+// such as the output of printenv or the body of a .env file. Lines are
+// parsed with the same rules as New, and may end in "\n" or "\r\n".
+//
+// Lines longer than MaxLineSize result in an error wrapping
+// bufio.ErrTooLong.
+func NewFromReader(r io.Reader) (*Environ, error) {
+	return NewFromReaderFiltered(r, func(string) bool {
+		return true
+	})
+}
+
+// NewFromReaderFiltered behaves like NewFromReader, but only holds the
+// variables whose keys keep returns true for, so the rest of a large input
+// is never stored.
+func NewFromReaderFiltered(r io.Reader, keep func(key string) bool) (*Environ, error) {
+	m := make(map[string]string)
+
+	scanner := newLineScanner(r)
+	for scanner.Scan() {
+		if k, v, ok := ParseLine(scanner.Text()); ok && keep(k) {
+			m[k] = v
+		}
+	}
+
+	if err := scanErr(scanner); err != nil {
+		return nil, err
+	}
+
+	return newEnviron(m), nil
+}
+
+func newLineScanner(r io.Reader) *bufio.Scanner {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), MaxLineSize)
+
+	return scanner
+}
+
+func scanErr(scanner *bufio.Scanner) error {
+	err := scanner.Err()
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, bufio.ErrTooLong):
+		return fmt.Errorf("reading env: line longer than %d bytes: %w", MaxLineSize, err)
+	default:
+		return fmt.Errorf("reading env: %w", err)
+	}
+}
+
+// WriteTo satisfies io.WriterTo, writing the Environ to w as "key=value"
+// lines in lexical key order. It returns the number of bytes written.
+func (e *Environ) WriteTo(w io.Writer) (int64, error) {
+	defer e.readLocker()()
+
+	m := e.view()
+
+	var total int64
+	for _, k := range keys(m) {
+		n, err := io.WriteString(w, k+"="+m[k]+"\n")
+		total += int64(n)
+		if err != nil {
+			return total, err
+		}
+	}
+
+	return total, nil
+}
+
+// MergeFile reads a .env style file from path, using the same rules as
+// LoadFile, and overlays its values onto the Environ, clobbering any
+// existing keys. Keys are set in the order the file lists them.
+func (e *Environ) MergeFile(path string) error {
+	lines, err := readLines(path)
+	if err != nil {
+		return err
+	}
+
+	defer e.writeLocker()()
+
+	e.putLines(lines)
+
+	return nil
+}
+
+func readLines(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading env file: %w", err)
+	}
+
+	return splitLines(string(data)), nil
+}
+
+// splitLines splits s on "\n", dropping any "\r" before it. Text ending in
+// a newline yields a final empty line.
+func splitLines(s string) []string {
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSuffix(line, "\r")
+	}
+
+	return lines
+}
+
+// WriteFile writes the Environ to path as a .env style file, one
+// "key=value" line per entry in the same order as AsSlice.
+//
+// The file is written to a temporary file in the same directory and renamed
+// into place, so a failure never leaves a partially written file at path.
+//
+// Values are not escaped. An entry containing a newline or carriage return
+// could not be read back by LoadFile, so WriteFile rejects it with an error
+// naming the key, and leaves path untouched.
+func (e *Environ) WriteFile(path string, perm os.FileMode) error {
+	m := e.AsMap()
+	for _, k := range keys(m) {
+		if strings.ContainsAny(k+m[k], "\r\n") {
+			return fmt.Errorf("writing env file: key %q contains a line break", k)
+		}
+	}
+
+	return writeFileAtomic(path, perm, func(w io.Writer) error {
+		for _, line := range envMapAsSlice(m) {
+			if _, err := io.WriteString(w, line+"\n"); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// writeFileAtomic calls write with a temporary file in the same directory
+// as path, then renames it into place, so a failure never leaves a
+// partially written file at path.
+func writeFileAtomic(path string, perm os.FileMode, write func(w io.Writer) error) (err error) {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("writing env file: %w", err)
+	}
+
+	defer func() {
+		if err != nil {
+			_ = tmp.Close()
+			_ = os.Remove(tmp.Name())
+		}
+	}()
+
+	if err = write(tmp); err != nil {
+		return fmt.Errorf("writing env file: %w", err)
+	}
+
+	if err = tmp.Chmod(perm); err != nil {
+		return fmt.Errorf("writing env file: %w", err)
+	}
+
+	if err = tmp.Sync(); err != nil {
+		return fmt.Errorf("writing env file: %w", err)
+	}
+
+	if err = tmp.Close(); err != nil {
+		return fmt.Errorf("writing env file: %w", err)
+	}
+
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("writing env file: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,195 @@
+package environ_test
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/metrumresearchgroup/environ"
+)
+
+func writeTestFile(t *testing.T, contents string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+		t.Fatalf("writing test file: %v", err)
+	}
+
+	return path
+}
+
+func TestLoadFile(t *testing.T) {
+	path := writeTestFile(t, "# comment\r\nA=A\r\n\r\nB=B\nNOEQUALS\nC=\n")
+
+	env, err := environ.LoadFile(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !reflect.DeepEqual(env.AsSlice(), []string{"A=A", "B=B", "C="}) {
+		t.Fatalf("unexpected slice: %v", env.AsSlice())
+	}
+}
+
+func TestLoadFileMissing(t *testing.T) {
+	_, err := environ.LoadFile(filepath.Join(t.TempDir(), "missing.env"))
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected wrapped os.ErrNotExist, got: %v", err)
+	}
+}
+
+func TestMergeFile(t *testing.T) {
+	path := writeTestFile(t, "B=Bee\nC=C\n")
+
+	env := environ.New([]string{"A=A", "B=B"})
+	if err := env.MergeFile(path); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !reflect.DeepEqual(env.AsSlice(), []string{"A=A", "B=Bee", "C=C"}) {
+		t.Fatalf("unexpected slice: %v", env.AsSlice())
+	}
+
+	if err := env.MergeFile(filepath.Join(t.TempDir(), "missing.env")); err == nil {
+		t.Fatalf("expected an error which did not occur")
+	}
+}
+
+func TestWriteFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".env")
+
+	env := environ.New([]string{"B=B", "A=A", "C="})
+	if err := env.WriteFile(path, 0o640); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading written file: %v", err)
+	}
+
+	if string(data) != "A=A\nB=B\nC=\n" {
+		t.Fatalf("unexpected contents: %q", data)
+	}
+
+	loaded, err := environ.LoadFile(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !reflect.DeepEqual(loaded.AsSlice(), env.AsSlice()) {
+		t.Fatalf("expected round trip, got: %v", loaded.AsSlice())
+	}
+}
+
+func TestWriteFileRejectsNewlines(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, ".env")
+
+	env := environ.New([]string{"A=A"})
+	env.Set("B", "line one\nline two")
+
+	if err := env.WriteFile(path, 0o600); err == nil {
+		t.Fatalf("expected an error which did not occur")
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("reading dir: %v", err)
+	}
+
+	if len(entries) != 0 {
+		t.Fatalf("expected no files to be left behind, found %d", len(entries))
+	}
+}
+
+func TestNewFromReader(t *testing.T) {
+	env, err := environ.NewFromReader(strings.NewReader("# comment\r\nA=A\r\n\nB=B=B\nNOEQUALS\nC="))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !reflect.DeepEqual(env.AsSlice(), []string{"A=A", "B=B=B", "C="}) {
+		t.Fatalf("unexpected slice: %v", env.AsSlice())
+	}
+
+	env.Set("D", "D")
+	if env.Get("D") != "D" {
+		t.Fatalf("environ not usable")
+	}
+}
+
+func TestNewFromReaderFiltered(t *testing.T) {
+	input := "# comment\nGITHUB_A=A\nOTHER=O\nGITHUB_B=B\nNOEQUALS\n"
+
+	var seen []string
+	env, err := environ.NewFromReaderFiltered(strings.NewReader(input), func(key string) bool {
+		seen = append(seen, key)
+
+		return strings.HasPrefix(key, "GITHUB_")
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !reflect.DeepEqual(env.AsSlice(), []string{"GITHUB_A=A", "GITHUB_B=B"}) {
+		t.Fatalf("unexpected slice: %v", env.AsSlice())
+	}
+
+	if !reflect.DeepEqual(seen, []string{"GITHUB_A", "OTHER", "GITHUB_B"}) {
+		t.Fatalf("keep called with unexpected keys: %v", seen)
+	}
+}
+
+func TestNewFromReaderLongLine(t *testing.T) {
+	long := "A=" + strings.Repeat("a", environ.MaxLineSize)
+
+	_, err := environ.NewFromReader(strings.NewReader(long))
+	if !errors.Is(err, bufio.ErrTooLong) {
+		t.Fatalf("expected wrapped bufio.ErrTooLong, got: %v", err)
+	}
+
+	ok := "A=" + strings.Repeat("a", 1<<20)
+
+	env, err := environ.NewFromReader(strings.NewReader(ok))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(env.Get("A")) != 1<<20 {
+		t.Fatalf("long value truncated to %d bytes", len(env.Get("A")))
+	}
+}
+
+func TestWriteTo(t *testing.T) {
+	env := environ.New([]string{"B=B", "A=A", "C="})
+
+	var buf bytes.Buffer
+	n, err := env.WriteTo(&buf)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if buf.String() != "A=A\nB=B\nC=\n" {
+		t.Fatalf("unexpected output: %q", buf.String())
+	}
+
+	if n != int64(buf.Len()) {
+		t.Fatalf("expected %d bytes written, got %d", buf.Len(), n)
+	}
+
+	loaded, err := environ.NewFromReader(&buf)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !reflect.DeepEqual(loaded.AsSlice(), env.AsSlice()) {
+		t.Fatalf("expected round trip, got: %v", loaded.AsSlice())
+	}
+}
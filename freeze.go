@@ -0,0 +1,19 @@
+package environ
+
+// Freeze returns a read-only copy of the Environ, for handing to code which
+// mustn't change it. Every read method works as usual, while any method
+// which would modify the copy, such as Set, Unset, Keep, Drop or Merge,
+// panics. Later changes to the Environ don't affect the copy.
+//
+// Clone and Child of a frozen Environ may be modified.
+func (e *Environ) Freeze() *Environ {
+	f := e.Clone()
+	f.frozen = true
+
+	return f
+}
+
+// Frozen reports whether the Environ was returned by Freeze.
+func (e *Environ) Frozen() bool {
+	return e.frozen
+}
@@ -0,0 +1,58 @@
+package environ_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/metrumresearchgroup/environ"
+)
+
+func TestFreeze(t *testing.T) {
+	env := environ.New([]string{"A=A", "B=B"})
+	frozen := env.Freeze()
+
+	env.Set("C", "C")
+
+	if !frozen.Frozen() || env.Frozen() {
+		t.Fatalf("unexpected Frozen: %v, %v", frozen.Frozen(), env.Frozen())
+	}
+
+	if !reflect.DeepEqual(frozen.AsSlice(), []string{"A=A", "B=B"}) || frozen.Get("A") != "A" || frozen.Len() != 2 {
+		t.Fatalf("unexpected frozen environ: %v", frozen.AsSlice())
+	}
+
+	mutations := map[string]func(){
+		"Set":   func() { frozen.Set("A", "changed") },
+		"Unset": func() { frozen.Unset("A") },
+		"Keep":  func() { _, _ = frozen.Keep("A") },
+		"Drop":  func() { _, _ = frozen.Drop("A") },
+		"Merge": func() { frozen.Merge(env) },
+		"Clear": frozen.Clear,
+	}
+
+	for name, mutate := range mutations {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Fatalf("%s: expected a panic", name)
+				}
+			}()
+
+			mutate()
+		}()
+	}
+
+	if !reflect.DeepEqual(frozen.AsSlice(), []string{"A=A", "B=B"}) {
+		t.Fatalf("frozen environ was modified: %v", frozen.AsSlice())
+	}
+
+	clone := frozen.Clone()
+	clone.Set("A", "changed")
+
+	child := frozen.Child()
+	child.Set("B", "changed")
+
+	if clone.Get("A") != "changed" || child.Get("B") != "changed" || frozen.Get("B") != "B" {
+		t.Fatalf("unexpected clone %v or child %v", clone.AsSlice(), child.AsSlice())
+	}
+}
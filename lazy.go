@@ -0,0 +1,77 @@
+package environ
+
+import (
+	"os"
+	"sync"
+)
+
+// FromOSLazy returns an Environ over the OS environment which, unlike
+// FromOS, doesn't read it up front. A key that hasn't been set or unset
+// locally is looked up with os.LookupEnv the first time it's read, and the
+// result, including its absence, is cached: later changes to the OS
+// environment aren't seen for keys already read.
+//
+// Set and Unset only affect the Environ, never the OS, so an unset key
+// reads as absent even while the OS still holds it. Reads over the whole
+// set, such as AsSlice, Keys and Len, take in every variable of the OS
+// environment at the time, caching them all, as do operations which
+// rewrite the whole set, such as Keep and Drop, after which the Environ no
+// longer reads from the OS at all.
+func FromOSLazy() *Environ {
+	e := newEnviron(make(map[string]string))
+	e.lazy = true
+	e.hidden = make(map[string]bool)
+	e.osCache = &osCache{m: make(map[string]osValue)}
+
+	return e
+}
+
+// osCache holds the OS variables a FromOSLazy Environ has read.
+type osCache struct {
+	sync.Mutex
+	m map[string]osValue
+}
+
+// osValue is a cached os.LookupEnv result.
+type osValue struct {
+	value string
+	ok    bool
+}
+
+// lookupOS returns key from the OS environment, caching the result.
+func (e *Environ) lookupOS(key string) (string, bool) {
+	e.osCache.Lock()
+	defer e.osCache.Unlock()
+
+	cached, ok := e.osCache.m[key]
+	if !ok {
+		cached.value, cached.ok = os.LookupEnv(key)
+		e.osCache.m[key] = cached
+	}
+
+	return cached.value, cached.ok
+}
+
+// osView returns a new map of the OS environment, preferring values already
+// cached, and caches the rest.
+func (e *Environ) osView() map[string]string {
+	current := envSliceAsMap(os.Environ())
+
+	e.osCache.Lock()
+	defer e.osCache.Unlock()
+
+	for k, v := range current {
+		if _, ok := e.osCache.m[k]; !ok {
+			e.osCache.m[k] = osValue{value: v, ok: true}
+		}
+	}
+
+	m := make(map[string]string, len(e.osCache.m))
+	for k, cached := range e.osCache.m {
+		if cached.ok {
+			m[k] = cached.value
+		}
+	}
+
+	return m
+}
@@ -0,0 +1,78 @@
+package environ_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/metrumresearchgroup/environ"
+)
+
+func TestFromOSLazy(t *testing.T) {
+	restoreOSEnv(t)
+
+	if err := os.Setenv("ENVIRON_LAZY_A", "A"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := os.Setenv("ENVIRON_LAZY_B", "B"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	env := environ.FromOSLazy()
+
+	if v := env.Get("ENVIRON_LAZY_A"); v != "A" {
+		t.Fatalf("unexpected value: %q", v)
+	}
+
+	if env.Has("ENVIRON_LAZY_MISSING") {
+		t.Fatalf("expected ENVIRON_LAZY_MISSING to be absent")
+	}
+
+	// values already read are cached, including absence.
+	_ = os.Setenv("ENVIRON_LAZY_A", "changed")
+	_ = os.Setenv("ENVIRON_LAZY_MISSING", "late")
+
+	if v := env.Get("ENVIRON_LAZY_A"); v != "A" {
+		t.Fatalf("expected the cached value, got %q", v)
+	}
+
+	if env.Has("ENVIRON_LAZY_MISSING") {
+		t.Fatalf("expected the cached absence")
+	}
+
+	env.Unset("ENVIRON_LAZY_B")
+	env.Set("ENVIRON_LAZY_C", "C")
+
+	if env.Has("ENVIRON_LAZY_B") {
+		t.Fatalf("expected ENVIRON_LAZY_B to be unset locally")
+	}
+
+	if v := os.Getenv("ENVIRON_LAZY_B"); v != "B" {
+		t.Fatalf("expected the OS to be untouched, got %q", v)
+	}
+
+	m := env.AsMap()
+	if m["ENVIRON_LAZY_A"] != "A" || m["ENVIRON_LAZY_C"] != "C" {
+		t.Fatalf("unexpected map: %v", m)
+	}
+
+	if _, ok := m["ENVIRON_LAZY_B"]; ok {
+		t.Fatalf("expected ENVIRON_LAZY_B to stay unset: %v", m)
+	}
+
+	if env.Len() != len(m) {
+		t.Fatalf("expected Len %d, got %d", len(m), env.Len())
+	}
+
+	if !env.Equal(env.Clone()) {
+		t.Fatalf("expected a clone to be equal")
+	}
+
+	if _, err := env.Keep("ENVIRON_LAZY_.*"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if env.Len() != 2 || env.Get("ENVIRON_LAZY_A") != "A" {
+		t.Fatalf("unexpected environ after Keep: %v", env.AsSlice())
+	}
+}
@@ -0,0 +1,46 @@
+package environ
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrLimitExceeded is wrapped by errors from NewLimited when the input
+// holds more than it allows.
+var ErrLimitExceeded = errors.New("environ limit exceeded")
+
+// NewLimited creates an Environ from a list of "key=value" strings, as New
+// does, but stops with an error wrapping ErrLimitExceeded as soon as the
+// Environ would hold more than maxEntries variables, or more than maxBytes
+// bytes of keys and values in total. A limit of zero or less isn't checked.
+//
+// Use it to guard against exhausting memory when reading untrusted input.
+func NewLimited(environ []string, maxEntries int, maxBytes int) (*Environ, error) {
+	m := make(map[string]string)
+
+	var size int
+	for _, line := range environ {
+		k, v, ok := ParseLine(line)
+		if !ok {
+			continue
+		}
+
+		old, existed := m[k]
+		if existed {
+			size -= len(k) + len(old)
+		}
+
+		size += len(k) + len(v)
+		if maxBytes > 0 && size > maxBytes {
+			return nil, fmt.Errorf("more than %d bytes: %w", maxBytes, ErrLimitExceeded)
+		}
+
+		if !existed && maxEntries > 0 && len(m) == maxEntries {
+			return nil, fmt.Errorf("more than %d entries: %w", maxEntries, ErrLimitExceeded)
+		}
+
+		m[k] = v
+	}
+
+	return newEnviron(m), nil
+}
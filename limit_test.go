@@ -0,0 +1,37 @@
+package environ_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/metrumresearchgroup/environ"
+)
+
+func TestNewLimited(t *testing.T) {
+	lines := []string{"A=1", "# comment", "B=22", "A=3"}
+
+	env, err := environ.NewLimited(lines, 2, 5)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !reflect.DeepEqual(env.AsSlice(), []string{"A=3", "B=22"}) {
+		t.Fatalf("unexpected slice: %v", env.AsSlice())
+	}
+
+	if _, err = environ.NewLimited(lines, 0, 0); err != nil {
+		t.Fatalf("unexpected error without limits: %v", err)
+	}
+
+	for _, limits := range [][2]int{{1, 0}, {0, 4}} {
+		env, err = environ.NewLimited(lines, limits[0], limits[1])
+		if !errors.Is(err, environ.ErrLimitExceeded) {
+			t.Fatalf("expected ErrLimitExceeded for limits %v, got: %v", limits, err)
+		}
+
+		if env != nil {
+			t.Fatalf("expected no environ for limits %v", limits)
+		}
+	}
+}
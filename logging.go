@@ -0,0 +1,92 @@
+package environ
+
+// loggingEnv is the Env returned by NewLogging.
+type loggingEnv struct {
+	e    *Environ
+	logf func(format string, args ...interface{})
+}
+
+// NewLogging returns an Env which forwards every call to e, and logs each
+// Set, Unset, Keep and Drop through logf, such as log.Printf or t.Logf,
+// with the keys and values involved. Reads aren't logged. As in String,
+// the values of keys matching SecretKeyPatterns or registered with
+// RegisterSecret are logged as "***".
+//
+// Changes made to e directly, rather than through the Env, aren't logged.
+func NewLogging(e *Environ, logf func(format string, args ...interface{})) Env {
+	return &loggingEnv{e: e, logf: logf}
+}
+
+func (l *loggingEnv) Get(key string) string {
+	return l.e.Get(key)
+}
+
+func (l *loggingEnv) Has(key string) bool {
+	return l.e.Has(key)
+}
+
+func (l *loggingEnv) Keys() []string {
+	return l.e.Keys()
+}
+
+func (l *loggingEnv) AsMap() map[string]string {
+	return l.e.AsMap()
+}
+
+func (l *loggingEnv) AsSlice() []string {
+	return l.e.AsSlice()
+}
+
+func (l *loggingEnv) Set(key, val string) {
+	event, observers := l.e.set(key, val)
+	if event == nil {
+		l.logf("environ: Set %s=%q (unchanged)", key, l.value(key, val))
+	} else {
+		l.logf("environ: Set %s=%q (was %q)", event.Key, l.value(event.Key, val), l.value(event.Key, event.Old))
+	}
+
+	l.e.notify(event, observers)
+}
+
+func (l *loggingEnv) Unset(key string) {
+	event, observers := l.e.unset(key)
+	if event == nil {
+		l.logf("environ: Unset %s (not set)", key)
+	} else {
+		l.logf("environ: Unset %s (was %q)", event.Key, l.value(event.Key, event.Old))
+	}
+
+	l.e.notify(event, observers)
+}
+
+func (l *loggingEnv) Keep(patterns ...string) (missing []string, err error) {
+	kept, missing, err := l.e.KeepReport(patterns...)
+	if err != nil {
+		l.logf("environ: Keep %q failed: %v", patterns, err)
+	} else {
+		l.logf("environ: Keep %q kept %q, missing %q", patterns, kept, missing)
+	}
+
+	return missing, err
+}
+
+func (l *loggingEnv) Drop(patterns ...string) (missing []string, err error) {
+	dropped, missing, err := l.e.DropReport(patterns...)
+	if err != nil {
+		l.logf("environ: Drop %q failed: %v", patterns, err)
+	} else {
+		l.logf("environ: Drop %q dropped %q, missing %q", patterns, dropped, missing)
+	}
+
+	return missing, err
+}
+
+// value returns val, or "***" if it's set and key matches
+// SecretKeyPatterns or a pattern registered with RegisterSecret.
+func (l *loggingEnv) value(key, val string) string {
+	if val != "" && l.e.secretKeys()(key) {
+		return redacted
+	}
+
+	return val
+}
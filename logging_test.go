@@ -0,0 +1,59 @@
+package environ_test
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/metrumresearchgroup/environ"
+)
+
+func TestNewLogging(t *testing.T) {
+	env := environ.New([]string{"A=A", "B=B", "C=C"})
+	if err := env.RegisterSecret("CREDS"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var logged []string
+	logging := environ.NewLogging(env, func(format string, args ...interface{}) {
+		logged = append(logged, fmt.Sprintf(format, args...))
+	})
+
+	logging.Set("A", "Apple")
+	logging.Set("A", "Apple")
+	logging.Set("API_TOKEN", "hunter2")
+	logging.Set("CREDS", "s3cret")
+	logging.Unset("CREDS")
+	logging.Unset("B")
+	logging.Unset("MISSING")
+
+	if _, err := logging.Drop("C", "Z"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, err := logging.Keep(`bad\K`); err == nil {
+		t.Fatalf("expected an error which did not occur")
+	}
+
+	_ = logging.Get("A")
+	_ = logging.AsSlice()
+
+	want := []string{
+		`environ: Set A="Apple" (was "A")`,
+		`environ: Set A="Apple" (unchanged)`,
+		`environ: Set API_TOKEN="***" (was "")`,
+		`environ: Set CREDS="***" (was "")`,
+		`environ: Unset CREDS (was "***")`,
+		`environ: Unset B (was "B")`,
+		`environ: Unset MISSING (not set)`,
+		`environ: Drop ["C" "Z"] dropped ["C"], missing ["Z"]`,
+		"environ: Keep [\"bad\\\\K\"] failed: error parsing regexp: invalid escape sequence: `\\K`",
+	}
+	if !reflect.DeepEqual(logged, want) {
+		t.Fatalf("unexpected log:\n%q", logged)
+	}
+
+	if !reflect.DeepEqual(env.AsSlice(), []string{"A=Apple", "API_TOKEN=hunter2"}) {
+		t.Fatalf("unexpected environ: %v", env.AsSlice())
+	}
+}
@@ -0,0 +1,115 @@
+package environ
+
+// ChangeOp identifies the operation that produced a ChangeEvent.
+type ChangeOp int
+
+// The operations reported to OnChange callbacks.
+const (
+	OpSet ChangeOp = iota + 1
+	OpUnset
+)
+
+// String returns the name of the method that performs the operation.
+func (op ChangeOp) String() string {
+	switch op {
+	case OpSet:
+		return "Set"
+	case OpUnset:
+		return "Unset"
+	default:
+		return "ChangeOp(?)"
+	}
+}
+
+// A ChangeEvent describes a single change to an Environ.
+type ChangeEvent struct {
+	Op  ChangeOp
+	Key string
+
+	// Old is the previous value, or "" if the key was absent.
+	Old string
+
+	// New is the value after the change, or "" for OpUnset.
+	New string
+}
+
+// OnChange registers fn to be called after every change to the Environ's
+// own variables, with one event for each key that was set or unset.
+// Setting a key to the value it already holds, or unsetting a missing key,
+// is not a change. Rename reports an OpUnset of the old key followed by an
+// OpSet of the new one.
+//
+// Batch writes such as SetAll, Merge and UnsetAll report each key they
+// change. Writes to the Environ as a whole, such as Keep, Drop, Filter,
+// ExpandAll, Clear and UnmarshalJSON, compare the contents before and
+// after, so they cost a copy of the Environ while callbacks are
+// registered. Changes to a Child's parent aren't reported to the Child.
+//
+// Callbacks are called in registration order, on the goroutine that made
+// the change, after the lock is released, so they may read or modify the
+// Environ. A Clone doesn't inherit the callbacks.
+func (e *Environ) OnChange(fn func(event ChangeEvent)) {
+	defer e.writeLocker()()
+
+	e.observers = append(e.observers, fn)
+}
+
+func (e *Environ) notify(event *ChangeEvent, observers []func(ChangeEvent)) {
+	if event == nil {
+		return
+	}
+
+	for _, fn := range observers {
+		fn(*event)
+	}
+}
+
+// record queues event, if there is one, for the unlocker to send. The
+// caller must hold the write lock.
+func (e *Environ) record(event *ChangeEvent) {
+	if event != nil && len(e.observers) > 0 {
+		e.pending = append(e.pending, *event)
+	}
+}
+
+// snapshot keeps the current contents, when there are observers to tell,
+// so that the unlocker can report what a whole-set write changed. The
+// caller must hold the write lock.
+func (e *Environ) snapshot() {
+	if len(e.observers) > 0 && e.before == nil {
+		e.before = copyMap(e.view())
+	}
+}
+
+// rewrite prepares the Environ to be modified as a whole, taking a snapshot
+// for observers and materializing it. The caller must hold the write lock.
+func (e *Environ) rewrite() {
+	e.snapshot()
+	e.materialize()
+}
+
+// changeEvents describes the differences between before and after, in
+// lexical key order.
+func changeEvents(before, after map[string]string) []ChangeEvent {
+	all := copyMap(after)
+	for k, v := range before {
+		if _, ok := all[k]; !ok {
+			all[k] = v
+		}
+	}
+
+	var events []ChangeEvent
+	for _, k := range keys(all) {
+		old, existed := before[k]
+		val, exists := after[k]
+
+		switch {
+		case !exists:
+			events = append(events, ChangeEvent{Op: OpUnset, Key: k, Old: old})
+		case !existed || old != val:
+			events = append(events, ChangeEvent{Op: OpSet, Key: k, Old: old, New: val})
+		}
+	}
+
+	return events
+}
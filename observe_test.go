@@ -0,0 +1,152 @@
+package environ_test
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/metrumresearchgroup/environ"
+)
+
+func TestOnChange(t *testing.T) {
+	env := environ.New([]string{"A=A"})
+
+	var first, second []environ.ChangeEvent
+	env.OnChange(func(event environ.ChangeEvent) {
+		first = append(first, event)
+		second = append(second, environ.ChangeEvent{})
+
+		// reading the environ from a callback mustn't deadlock.
+		_ = env.Get(event.Key)
+	})
+	env.OnChange(func(event environ.ChangeEvent) {
+		second[len(second)-1] = event
+	})
+
+	env.Set("A", "Apple")
+	env.Set("A", "Apple")
+	env.Set("B", "B")
+	env.Unset("A")
+	env.Unset("C")
+
+	want := []environ.ChangeEvent{
+		{Op: environ.OpSet, Key: "A", Old: "A", New: "Apple"},
+		{Op: environ.OpSet, Key: "B", Old: "", New: "B"},
+		{Op: environ.OpUnset, Key: "A", Old: "Apple", New: ""},
+	}
+
+	if !reflect.DeepEqual(first, want) {
+		t.Fatalf("unexpected events: %+v", first)
+	}
+
+	if !reflect.DeepEqual(second, want) {
+		t.Fatalf("second callback didn't fire after the first: %+v", second)
+	}
+
+	if environ.OpSet.String() != "Set" || environ.OpUnset.String() != "Unset" {
+		t.Fatalf("unexpected op names: %v, %v", environ.OpSet, environ.OpUnset)
+	}
+}
+
+func TestOnChangeSingleKeyWrites(t *testing.T) {
+	env := environ.New([]string{"A=A", "PATH=/bin"})
+
+	var events []environ.ChangeEvent
+	env.OnChange(func(event environ.ChangeEvent) {
+		events = append(events, event)
+	})
+
+	env.SetIfAbsent("A", "x")
+	env.SetIfAbsent("B", "B")
+	env.Rename("A", "C")
+	env.Rename("MISSING", "D")
+	env.Rename("C", "C")
+	env.AppendPath("PATH", "/usr/bin")
+	env.AppendPath("PATH", "/usr/bin")
+	env.AppendToList("NO_PROXY", "localhost", ",")
+
+	want := []environ.ChangeEvent{
+		{Op: environ.OpSet, Key: "B", New: "B"},
+		{Op: environ.OpUnset, Key: "A", Old: "A"},
+		{Op: environ.OpSet, Key: "C", New: "A"},
+		{Op: environ.OpSet, Key: "PATH", Old: "/bin", New: "/bin" + string(os.PathListSeparator) + "/usr/bin"},
+		{Op: environ.OpSet, Key: "NO_PROXY", New: "localhost"},
+	}
+
+	if !reflect.DeepEqual(events, want) {
+		t.Fatalf("unexpected events: %+v", events)
+	}
+}
+
+func TestOnChangeBatchWrites(t *testing.T) {
+	env := environ.New([]string{"A=A", "B=B", "C=C"})
+
+	var events []environ.ChangeEvent
+	env.OnChange(func(event environ.ChangeEvent) {
+		events = append(events, event)
+	})
+
+	env.SetAll(map[string]string{"B": "Bee", "A": "A", "D": "D"})
+	env.MergeSlice([]string{"E=E", "A=Apple"})
+	env.Merge(environ.New([]string{"C=C", "F=F"}))
+
+	if n := env.UnsetAll("F", "MISSING", "E"); n != 2 {
+		t.Fatalf("unexpected UnsetAll count: %d", n)
+	}
+
+	want := []environ.ChangeEvent{
+		{Op: environ.OpSet, Key: "B", Old: "B", New: "Bee"},
+		{Op: environ.OpSet, Key: "D", New: "D"},
+		{Op: environ.OpSet, Key: "E", New: "E"},
+		{Op: environ.OpSet, Key: "A", Old: "A", New: "Apple"},
+		{Op: environ.OpSet, Key: "F", New: "F"},
+		{Op: environ.OpUnset, Key: "F", Old: "F"},
+		{Op: environ.OpUnset, Key: "E", Old: "E"},
+	}
+
+	if !reflect.DeepEqual(events, want) {
+		t.Fatalf("unexpected events: %+v", events)
+	}
+}
+
+func TestOnChangeWholeSetWrites(t *testing.T) {
+	env := environ.New([]string{"A=A", "B=$A", "C=C"})
+
+	var events []environ.ChangeEvent
+	env.OnChange(func(event environ.ChangeEvent) {
+		events = append(events, event)
+
+		// the lock must be released before callbacks run.
+		_ = env.Len()
+	})
+
+	if _, err := env.Drop("C", "MISSING"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	env.ExpandAll()
+
+	if _, err := env.Keep("NONE"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := env.UnmarshalJSON([]byte(`["X=X"]`)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	env.Clear()
+	env.Clear()
+
+	want := []environ.ChangeEvent{
+		{Op: environ.OpUnset, Key: "C", Old: "C"},
+		{Op: environ.OpSet, Key: "B", Old: "$A", New: "A"},
+		{Op: environ.OpUnset, Key: "A", Old: "A"},
+		{Op: environ.OpUnset, Key: "B", Old: "A"},
+		{Op: environ.OpSet, Key: "X", New: "X"},
+		{Op: environ.OpUnset, Key: "X", Old: "X"},
+	}
+
+	if !reflect.DeepEqual(events, want) {
+		t.Fatalf("unexpected events: %+v", events)
+	}
+}
@@ -0,0 +1,119 @@
+package environ
+
+import "sort"
+
+// NewOrdered creates an Environ from a list of "key=value" strings which
+// remembers the order keys were added in, for AsSliceOrdered and
+// KeysOrdered. When the list holds a key more than once, the key keeps its
+// first position and takes its last value.
+//
+// Setting a key that's already present keeps its position, and unsetting
+// a key forgets it, so setting it again moves it to the end. Operations
+// which rewrite the whole set, such as NormalizeKeys, may leave keys they
+// add untracked; those are listed after the tracked keys in lexical order.
+// Clone keeps the order, while other derived Environs, such as those from
+// Subset or Child, are unordered.
+//
+// The order costs a slice and a second map holding every key alongside the
+// variables, but setting and unsetting keys still take constant time.
+func NewOrdered(environ []string) *Environ {
+	e := newEnviron(make(map[string]string, len(environ)))
+	e.ordered = true
+
+	for _, line := range environ {
+		if k, v, ok := ParseLine(line); ok {
+			e.put(k, v)
+		}
+	}
+
+	e.size = int64(len(e.m))
+
+	return e
+}
+
+// KeysOrdered returns the keys of the Environ in the order they were
+// added, for an Environ created by NewOrdered. For any other Environ it's
+// the same as Keys.
+func (e *Environ) KeysOrdered() []string {
+	defer e.readLocker()()
+
+	return e.orderedKeys(e.view())
+}
+
+// AsSliceOrdered behaves like AsSlice, but lists the variables in the
+// order KeysOrdered does.
+func (e *Environ) AsSliceOrdered() []string {
+	defer e.readLocker()()
+
+	m := e.view()
+	ordered := e.orderedKeys(m)
+
+	s := make([]string, 0, len(ordered))
+	for _, k := range ordered {
+		s = append(s, k+"="+m[k])
+	}
+
+	return s
+}
+
+// orderedKeys returns the keys of m, those tracked in e.order first. The
+// caller must hold a lock.
+func (e *Environ) orderedKeys(m map[string]string) []string {
+	ordered := make([]string, 0, len(m))
+	for i, k := range e.order {
+		if _, ok := m[k]; ok && e.position[k] == i {
+			ordered = append(ordered, k)
+		}
+	}
+
+	rest := make([]string, 0, len(m)-len(ordered))
+	for k := range m {
+		if _, ok := e.position[k]; !ok {
+			rest = append(rest, k)
+		}
+	}
+
+	sort.Strings(rest)
+
+	return append(ordered, rest...)
+}
+
+// setOrder replaces the order with keys. The caller must hold the write
+// lock, or be the only user of the Environ.
+func (e *Environ) setOrder(keys []string) {
+	e.order = keys
+	e.position = make(map[string]int, len(keys))
+
+	for i, k := range keys {
+		e.position[k] = i
+	}
+}
+
+// track records key as added last, unless it's already present. The
+// caller must hold the write lock.
+func (e *Environ) track(key string) {
+	if _, ok := e.m[key]; ok {
+		return
+	}
+
+	// neither untrack nor whole-set operations remove keys from the order,
+	// so compact it once it's mostly stale.
+	if len(e.order) > 2*len(e.m)+8 {
+		e.setOrder(e.orderedKeys(e.m))
+	}
+
+	if e.position == nil {
+		e.position = make(map[string]int)
+	}
+
+	// a key removed by a whole-set operation may still be listed; moving
+	// its position leaves the old entry stale.
+	e.position[key] = len(e.order)
+	e.order = append(e.order, key)
+}
+
+// untrack forgets key's position, leaving its entry in the order stale.
+// The caller must hold the write lock.
+func (e *Environ) untrack(key string) {
+	delete(e.position, key)
+}
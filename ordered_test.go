@@ -0,0 +1,154 @@
+package environ_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/metrumresearchgroup/environ"
+)
+
+func TestOrdered(t *testing.T) {
+	env := environ.NewOrdered([]string{"Z=Z", "# comment", "A=A", "M=M", "Z=Zed"})
+
+	if !reflect.DeepEqual(env.AsSliceOrdered(), []string{"Z=Zed", "A=A", "M=M"}) {
+		t.Fatalf("unexpected order: %v", env.AsSliceOrdered())
+	}
+
+	env.Set("B", "B")
+	env.Set("A", "Apple")
+	env.Unset("Z")
+	env.Set("Z", "Z")
+
+	if !reflect.DeepEqual(env.KeysOrdered(), []string{"A", "M", "B", "Z"}) {
+		t.Fatalf("unexpected order: %v", env.KeysOrdered())
+	}
+
+	if !reflect.DeepEqual(env.AsSlice(), []string{"A=Apple", "B=B", "M=M", "Z=Z"}) {
+		t.Fatalf("expected AsSlice to stay lexical: %v", env.AsSlice())
+	}
+
+	clone := env.Clone()
+	clone.Set("C", "C")
+
+	if !reflect.DeepEqual(clone.KeysOrdered(), []string{"A", "M", "B", "Z", "C"}) {
+		t.Fatalf("unexpected clone order: %v", clone.KeysOrdered())
+	}
+
+	if !reflect.DeepEqual(env.KeysOrdered(), []string{"A", "M", "B", "Z"}) {
+		t.Fatalf("clone modified the order: %v", env.KeysOrdered())
+	}
+}
+
+func TestOrderedAfterWholeSetOperations(t *testing.T) {
+	env := environ.NewOrdered([]string{"C=C", "B=B", "A=A"})
+
+	if _, err := env.Drop("B"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	env.Set("B", "B")
+
+	if !reflect.DeepEqual(env.KeysOrdered(), []string{"C", "A", "B"}) {
+		t.Fatalf("unexpected order: %v", env.KeysOrdered())
+	}
+
+	env.Clear()
+	for i := 0; i < 100; i++ {
+		env.Set("X", "X")
+		env.Clear()
+	}
+
+	env.Set("Y", "Y")
+	env.Set("X", "X")
+
+	if !reflect.DeepEqual(env.KeysOrdered(), []string{"Y", "X"}) {
+		t.Fatalf("unexpected order: %v", env.KeysOrdered())
+	}
+}
+
+func TestOrderedChurn(t *testing.T) {
+	env := environ.NewOrdered([]string{"A=A", "B=B", "C=C"})
+
+	for i := 0; i < 100; i++ {
+		env.Unset("A")
+		env.Set("A", "A")
+		env.Unset("B")
+		env.Set("B", "B")
+	}
+
+	if !reflect.DeepEqual(env.KeysOrdered(), []string{"C", "A", "B"}) {
+		t.Fatalf("unexpected order: %v", env.KeysOrdered())
+	}
+
+	if !reflect.DeepEqual(env.Clone().KeysOrdered(), []string{"C", "A", "B"}) {
+		t.Fatalf("unexpected clone order: %v", env.Clone().KeysOrdered())
+	}
+}
+
+func TestOrderedBatchWrites(t *testing.T) {
+	lines := []string{"Z=1", "A=1", "M=1", "Q=1", "B=1"}
+	want := []string{"Z", "A", "M", "Q", "B"}
+
+	env := environ.NewOrdered(nil)
+	env.SetAllSlice(lines)
+
+	if !reflect.DeepEqual(env.KeysOrdered(), want) {
+		t.Fatalf("unexpected order after SetAllSlice: %v", env.KeysOrdered())
+	}
+
+	env = environ.NewOrdered(nil)
+	env.MergeSlice(lines)
+
+	if !reflect.DeepEqual(env.KeysOrdered(), want) {
+		t.Fatalf("unexpected order after MergeSlice: %v", env.KeysOrdered())
+	}
+
+	env = environ.NewOrdered(nil)
+	if err := env.MergeJSON([]byte(`["Z=1","A=1","M=1","Q=1","B=1"]`)); err != nil {
+		t.Fatalf("error in MergeJSON(): %v", err)
+	}
+
+	if !reflect.DeepEqual(env.KeysOrdered(), want) {
+		t.Fatalf("unexpected order after MergeJSON: %v", env.KeysOrdered())
+	}
+
+	env = environ.NewOrdered(nil)
+	if err := env.MergeFile(writeTestFile(t, "Z=1\nA=1\nM=1\nQ=1\nB=1\n")); err != nil {
+		t.Fatalf("error in MergeFile(): %v", err)
+	}
+
+	if !reflect.DeepEqual(env.KeysOrdered(), want) {
+		t.Fatalf("unexpected order after MergeFile: %v", env.KeysOrdered())
+	}
+
+	sorted := []string{"A", "B", "M", "Q", "Z"}
+
+	env = environ.NewOrdered(nil)
+	env.SetAll(map[string]string{"Z": "1", "A": "1", "M": "1", "Q": "1", "B": "1"})
+
+	if !reflect.DeepEqual(env.KeysOrdered(), sorted) {
+		t.Fatalf("unexpected order after SetAll: %v", env.KeysOrdered())
+	}
+
+	env = environ.NewOrdered(nil)
+	env.Merge(environ.New(lines))
+
+	if !reflect.DeepEqual(env.KeysOrdered(), sorted) {
+		t.Fatalf("unexpected order after Merge: %v", env.KeysOrdered())
+	}
+
+	env = environ.NewOrdered([]string{"A=A", "B=B"})
+	env.Rename("A", "A")
+
+	if !reflect.DeepEqual(env.KeysOrdered(), []string{"A", "B"}) {
+		t.Fatalf("unexpected order after renaming a key to itself: %v", env.KeysOrdered())
+	}
+}
+
+func TestKeysOrderedUnordered(t *testing.T) {
+	env := environ.New([]string{"C=C", "A=A", "B=B"})
+
+	if !reflect.DeepEqual(env.KeysOrdered(), env.Keys()) {
+		t.Fatalf("expected lexical order: %v", env.KeysOrdered())
+	}
+}
@@ -0,0 +1,86 @@
+package environ
+
+import (
+	"os"
+	"strings"
+)
+
+// PathElements returns the value of key split on os.PathListSeparator, or
+// nil if key is missing or empty.
+func (e *Environ) PathElements(key string) []string {
+	defer e.readLocker()()
+
+	v, _ := e.get(e.lookup(key))
+
+	return splitList(v, string(os.PathListSeparator))
+}
+
+// AppendPath adds element to the end of the os.PathListSeparator delimited
+// list stored under key, such as PATH, unless it's already in the list.
+// A missing or empty value becomes just element.
+func (e *Environ) AppendPath(key, element string) {
+	e.notify(e.addToList(key, element, string(os.PathListSeparator), false))
+}
+
+// PrependPath adds element to the start of the os.PathListSeparator
+// delimited list stored under key, such as PATH, unless it's already in
+// the list, so repeated calls with the same element are harmless. A missing
+// or empty value becomes just element.
+func (e *Environ) PrependPath(key, element string) {
+	e.notify(e.addToList(key, element, string(os.PathListSeparator), true))
+}
+
+// ListElements returns the value of key split on sep, such as "," for
+// NO_PROXY, or nil if key is missing or empty.
+func (e *Environ) ListElements(key, sep string) []string {
+	defer e.readLocker()()
+
+	v, _ := e.get(e.lookup(key))
+
+	return splitList(v, sep)
+}
+
+// AppendToList adds element to the end of the sep delimited list stored
+// under key, unless it's already in the list, as AppendPath does for
+// os.PathListSeparator. A missing or empty value becomes just element.
+func (e *Environ) AppendToList(key, element, sep string) {
+	e.notify(e.addToList(key, element, sep, false))
+}
+
+func (e *Environ) addToList(key, element, sep string, prepend bool) (event *ChangeEvent, observers []func(ChangeEvent)) {
+	defer e.writeLocker()()
+
+	key = e.lookup(key)
+
+	v, existed := e.get(key)
+
+	elements := splitList(v, sep)
+	for _, existing := range elements {
+		if existing == element {
+			return nil, nil
+		}
+	}
+
+	if prepend {
+		elements = append([]string{element}, elements...)
+	} else {
+		elements = append(elements, element)
+	}
+
+	val := strings.Join(elements, sep)
+	e.put(key, val)
+
+	if existed && v == val {
+		return nil, nil
+	}
+
+	return &ChangeEvent{Op: OpSet, Key: key, Old: v, New: val}, e.observers
+}
+
+func splitList(value, sep string) []string {
+	if value == "" {
+		return nil
+	}
+
+	return strings.Split(value, sep)
+}
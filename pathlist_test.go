@@ -0,0 +1,68 @@
+package environ_test
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/metrumresearchgroup/environ"
+)
+
+func TestPathHelpers(t *testing.T) {
+	sep := string(os.PathListSeparator)
+	env := environ.New([]string{"PATH=/bin" + sep + "/usr/bin", "EMPTY="})
+
+	env.PrependPath("PATH", "/home/me/bin")
+	env.PrependPath("PATH", "/home/me/bin")
+	env.AppendPath("PATH", "/opt/bin")
+	env.AppendPath("PATH", "/bin")
+
+	want := []string{"/home/me/bin", "/bin", "/usr/bin", "/opt/bin"}
+	if !reflect.DeepEqual(env.PathElements("PATH"), want) {
+		t.Fatalf("unexpected elements: %v", env.PathElements("PATH"))
+	}
+
+	if env.Get("PATH") != strings.Join(want, sep) {
+		t.Fatalf("unexpected PATH: %q", env.Get("PATH"))
+	}
+
+	env.AppendPath("EMPTY", "/a")
+	env.PrependPath("MISSING", "/b")
+
+	if env.Get("EMPTY") != "/a" || env.Get("MISSING") != "/b" {
+		t.Fatalf("unexpected separators: %q, %q", env.Get("EMPTY"), env.Get("MISSING"))
+	}
+
+	if elements := env.PathElements("NOPE"); len(elements) != 0 {
+		t.Fatalf("unexpected elements: %v", elements)
+	}
+}
+
+func TestListHelpers(t *testing.T) {
+	env := environ.New([]string{"NO_PROXY=localhost,127.0.0.1", "EMPTY="})
+
+	env.AppendToList("NO_PROXY", ".internal", ",")
+	env.AppendToList("NO_PROXY", "localhost", ",")
+
+	want := []string{"localhost", "127.0.0.1", ".internal"}
+	if !reflect.DeepEqual(env.ListElements("NO_PROXY", ","), want) {
+		t.Fatalf("unexpected elements: %v", env.ListElements("NO_PROXY", ","))
+	}
+
+	if env.Get("NO_PROXY") != "localhost,127.0.0.1,.internal" {
+		t.Fatalf("unexpected NO_PROXY: %q", env.Get("NO_PROXY"))
+	}
+
+	env.AppendToList("EMPTY", "a", ", ")
+	env.AppendToList("EMPTY", "b", ", ")
+	env.AppendToList("MISSING", "c", ";")
+
+	if env.Get("EMPTY") != "a, b" || env.Get("MISSING") != "c" {
+		t.Fatalf("unexpected separators: %q, %q", env.Get("EMPTY"), env.Get("MISSING"))
+	}
+
+	if elements := env.ListElements("NOPE", ","); elements != nil {
+		t.Fatalf("unexpected elements: %v", elements)
+	}
+}
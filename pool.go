@@ -0,0 +1,62 @@
+package environ
+
+import "sync"
+
+var pool = sync.Pool{
+	New: func() interface{} {
+		return New(nil)
+	},
+}
+
+// maxPooledSize is the most variables an Environ may have held for its map
+// to be kept by ReleaseEnviron, so the pool doesn't pin very large maps.
+const maxPooledSize = 1024
+
+// AcquireEnviron returns an empty Environ from a pool shared across the
+// process, avoiding an allocation when one is available. Pass it to
+// ReleaseEnviron once it's no longer needed.
+func AcquireEnviron() *Environ {
+	return pool.Get().(*Environ)
+}
+
+// ReleaseEnviron empties e and returns it to the pool used by
+// AcquireEnviron. e mustn't be used afterwards, by the caller or anything
+// it was handed to, as it may already belong to someone else.
+//
+// Any Environ may be released, not only those from AcquireEnviron; its
+// settings, such as case insensitivity, OnChange callbacks and registered
+// secrets, are reset. Frozen Environs are left alone.
+func ReleaseEnviron(e *Environ) {
+	if e == nil || e.l == nil || e.frozen {
+		return
+	}
+
+	e.reset()
+	pool.Put(e)
+}
+
+// reset returns e to the state New(nil) would create it in.
+func (e *Environ) reset() {
+	defer e.writeLocker()()
+
+	if len(e.m) > maxPooledSize {
+		e.m = make(map[string]string)
+	} else {
+		for k := range e.m {
+			delete(e.m, k)
+		}
+	}
+
+	e.fold = false
+	e.folded = nil
+	e.ordered = false
+	e.order = nil
+	e.position = nil
+	e.observers = nil
+	e.secrets = nil
+	e.parent = nil
+	e.hidden = nil
+	e.detached = false
+	e.lazy = false
+	e.osCache = nil
+}
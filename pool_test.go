@@ -0,0 +1,66 @@
+package environ_test
+
+import (
+	"testing"
+
+	"github.com/metrumresearchgroup/environ"
+)
+
+func TestAcquireRelease(t *testing.T) {
+	env := environ.AcquireEnviron()
+	if env.Len() != 0 {
+		t.Fatalf("expected an empty environ: %v", env.AsSlice())
+	}
+
+	env.Set("A", "A")
+	environ.ReleaseEnviron(env)
+
+	child := environ.New([]string{"B=B"}).Child()
+	environ.ReleaseEnviron(child)
+
+	lazy := environ.FromOSLazy()
+	environ.ReleaseEnviron(lazy)
+
+	folded := environ.NewCaseInsensitive([]string{"C=C"})
+	environ.ReleaseEnviron(folded)
+
+	for i := 0; i < 8; i++ {
+		env = environ.AcquireEnviron()
+		if env.Len() != 0 || len(env.AsSlice()) != 0 {
+			t.Fatalf("expected a reset environ: %v", env.AsSlice())
+		}
+
+		env.Set("c", "c")
+		if env.Has("C") {
+			t.Fatalf("expected case-sensitive lookups after reset")
+		}
+	}
+
+	environ.ReleaseEnviron(nil)
+	environ.ReleaseEnviron(environ.New(nil).Freeze())
+}
+
+func BenchmarkAcquireRelease(b *testing.B) {
+	b.ReportAllocs()
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			env := environ.AcquireEnviron()
+			env.Set("A", "A")
+			env.Set("B", "B")
+			environ.ReleaseEnviron(env)
+		}
+	})
+}
+
+func BenchmarkNewDiscard(b *testing.B) {
+	b.ReportAllocs()
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			env := environ.New(nil)
+			env.Set("A", "A")
+			env.Set("B", "B")
+		}
+	})
+}
@@ -0,0 +1,45 @@
+package environ
+
+import (
+	"encoding/json"
+)
+
+// RegisterSecret marks the keys matching keyPattern as holding secrets,
+// whose values MarshalJSONRedacted, String and StringRedacted replace with
+// "***". The pattern is treated as a regular expression which must match
+// the whole key, as in Keep and Drop, and an error is returned if it fails
+// to compile.
+//
+// Registration only affects redacted output; the values themselves are
+// unchanged. Clone copies the registered patterns.
+func (e *Environ) RegisterSecret(keyPattern string) error {
+	regex, err := compileAnchored(keyPattern)
+	if err != nil {
+		return err
+	}
+
+	defer e.writeLocker()()
+
+	e.secrets = append(e.secrets, regex)
+
+	return nil
+}
+
+// MarshalJSONRedacted behaves like MarshalJSON, but replaces the values of
+// keys registered with RegisterSecret with "***".
+func (e *Environ) MarshalJSONRedacted() ([]byte, error) {
+	defer e.readLocker()()
+
+	m := copyMap(e.view())
+	for k := range m {
+		for _, secret := range e.secrets {
+			if secret.MatchString(k) {
+				m[k] = redacted
+
+				break
+			}
+		}
+	}
+
+	return json.Marshal(envMapAsSlice(m))
+}
@@ -0,0 +1,50 @@
+package environ_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/metrumresearchgroup/environ"
+)
+
+func TestMarshalJSONRedacted(t *testing.T) {
+	env := environ.New([]string{"DB_PASSWORD=hunter2", "API_TOKEN=abc", "TOKENIZER=keep", "HOME=/home/me"})
+
+	for _, pattern := range []string{".*PASSWORD", ".*_TOKEN"} {
+		if err := env.RegisterSecret(pattern); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	if err := env.RegisterSecret(`unsupported\K`); err == nil {
+		t.Fatalf("expected an error which did not occur")
+	}
+
+	marshaled, err := env.MarshalJSONRedacted()
+	if err != nil {
+		t.Fatalf("error in MarshalJSONRedacted(): %v", err)
+	}
+
+	want := `["API_TOKEN=***","DB_PASSWORD=***","HOME=/home/me","TOKENIZER=keep"]`
+	if string(marshaled) != want {
+		t.Fatalf("unexpected JSON: %s", marshaled)
+	}
+
+	if env.Get("DB_PASSWORD") != "hunter2" {
+		t.Fatalf("redaction modified the value")
+	}
+
+	plain, err := env.MarshalJSON()
+	if err != nil {
+		t.Fatalf("error in MarshalJSON(): %v", err)
+	}
+
+	if string(plain) == want {
+		t.Fatalf("expected MarshalJSON not to redact")
+	}
+
+	clone, err := env.Clone().MarshalJSONRedacted()
+	if err != nil || !reflect.DeepEqual(clone, marshaled) {
+		t.Fatalf("expected clone to keep registered secrets: %s, %v", clone, err)
+	}
+}
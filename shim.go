@@ -0,0 +1,36 @@
+package environ
+
+import (
+	"fmt"
+	"strings"
+)
+
+// The methods in this file mirror the signatures of their namesakes in the
+// os package, so code written against os.Getenv and friends can be pointed
+// at an Environ through an interface, for example in tests.
+
+// Getenv behaves like os.Getenv, returning the value under key or "" if
+// it's missing.
+func (e *Environ) Getenv(key string) string {
+	return e.Get(key)
+}
+
+// Setenv behaves like os.Setenv. As with the os package, a key that is
+// empty or contains "=" or a NUL byte is rejected with an error, wrapping
+// ErrInvalidKey.
+func (e *Environ) Setenv(key, value string) error {
+	if key == "" || strings.ContainsAny(key, "=\x00") {
+		return fmt.Errorf("setenv %q: %w", key, ErrInvalidKey)
+	}
+
+	e.Set(key, value)
+
+	return nil
+}
+
+// Unsetenv behaves like os.Unsetenv. It never fails.
+func (e *Environ) Unsetenv(key string) error {
+	e.Unset(key)
+
+	return nil
+}
@@ -0,0 +1,57 @@
+package environ_test
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/metrumresearchgroup/environ"
+)
+
+// osEnv is the sort of interface a caller might declare to swap the os
+// package for an Environ.
+type osEnv interface {
+	Getenv(key string) string
+	Setenv(key, value string) error
+	Unsetenv(key string) error
+}
+
+type osPackage struct{}
+
+func (osPackage) Getenv(key string) string       { return os.Getenv(key) }
+func (osPackage) Setenv(key, value string) error { return os.Setenv(key, value) }
+func (osPackage) Unsetenv(key string) error      { return os.Unsetenv(key) }
+
+var (
+	_ osEnv = osPackage{}
+	_ osEnv = (*environ.Environ)(nil)
+)
+
+func TestShim(t *testing.T) {
+	env := environ.New([]string{"A=A"})
+
+	var shim osEnv = env
+
+	if got := shim.Getenv("A"); got != "A" {
+		t.Fatalf("unexpected value: %q", got)
+	}
+
+	if err := shim.Setenv("B", "B"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := shim.Unsetenv("A"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, key := range []string{"", "A=B", "A\x00"} {
+		if err := shim.Setenv(key, "x"); !errors.Is(err, environ.ErrInvalidKey) {
+			t.Fatalf("expected ErrInvalidKey for %q, got: %v", key, err)
+		}
+	}
+
+	if !reflect.DeepEqual(env.AsSlice(), []string{"B=B"}) {
+		t.Fatalf("unexpected slice: %v", env.AsSlice())
+	}
+}
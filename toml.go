@@ -0,0 +1,108 @@
+package environ
+
+import (
+	"fmt"
+	"strings"
+)
+
+// The methods in this file satisfy the Marshaler and Unmarshaler interfaces
+// of github.com/BurntSushi/toml without importing it, so the package
+// doesn't depend on a TOML library.
+
+// MarshalTOML satisfies the toml.Marshaler interface, representing the
+// Environ as an inline table of string values in lexical key order. Keys
+// which aren't valid bare TOML keys are quoted.
+func (e *Environ) MarshalTOML() ([]byte, error) {
+	defer e.readLocker()()
+
+	m := e.view()
+
+	pairs := make([]string, 0, len(m))
+	for _, k := range keys(m) {
+		pairs = append(pairs, tomlKey(k)+" = "+tomlQuote(m[k]))
+	}
+
+	if len(pairs) == 0 {
+		return []byte("{}"), nil
+	}
+
+	return []byte("{ " + strings.Join(pairs, ", ") + " }"), nil
+}
+
+// UnmarshalTOML satisfies the toml.Unmarshaler interface, reading a table
+// of string values.
+func (e *Environ) UnmarshalTOML(data interface{}) error {
+	table, ok := data.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("expected a table, got %T", data)
+	}
+
+	m := make(map[string]string, len(table))
+	for _, k := range keysOf(table) {
+		v, ok := table[k].(string)
+		if !ok {
+			return fmt.Errorf("value of %q is %T, not a string", k, table[k])
+		}
+
+		m[k] = v
+	}
+
+	e.replace(m)
+
+	return nil
+}
+
+func tomlKey(k string) string {
+	if k == "" {
+		return `""`
+	}
+
+	for _, r := range k {
+		if !isBareKeyRune(r) {
+			return tomlQuote(k)
+		}
+	}
+
+	return k
+}
+
+func isBareKeyRune(r rune) bool {
+	return r >= 'A' && r <= 'Z' || r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '_' || r == '-'
+}
+
+// tomlQuote returns s as a TOML basic string, which only allows the escape
+// sequences below.
+func tomlQuote(s string) string {
+	var b strings.Builder
+
+	b.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			b.WriteString(`\"`)
+		case '\\':
+			b.WriteString(`\\`)
+		case '\b':
+			b.WriteString(`\b`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\f':
+			b.WriteString(`\f`)
+		case '\r':
+			b.WriteString(`\r`)
+		default:
+			if r < 0x20 || r == 0x7f {
+				fmt.Fprintf(&b, `\u%04X`, r)
+
+				continue
+			}
+
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte('"')
+
+	return b.String()
+}
@@ -0,0 +1,49 @@
+package environ_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/metrumresearchgroup/environ"
+)
+
+func TestMarshalTOML(t *testing.T) {
+	env := environ.New([]string{"PATH=/bin", "MY.VAR=a \"quoted\"\tvalue", "my-var_2=x\\y", "SP ACE=\x01"})
+
+	marshaled, err := env.MarshalTOML()
+	if err != nil {
+		t.Fatalf("error in MarshalTOML(): %v", err)
+	}
+
+	want := `{ "MY.VAR" = "a \"quoted\"\tvalue", PATH = "/bin", "SP ACE" = "\u0001", my-var_2 = "x\\y" }`
+	if string(marshaled) != want {
+		t.Fatalf("unexpected TOML:\n%s\nwant:\n%s", marshaled, want)
+	}
+
+	empty, err := environ.New(nil).MarshalTOML()
+	if err != nil || string(empty) != "{}" {
+		t.Fatalf("unexpected empty TOML: %s, %v", empty, err)
+	}
+}
+
+func TestUnmarshalTOML(t *testing.T) {
+	env := new(environ.Environ)
+
+	// a TOML decoder hands over tables in this form.
+	err := env.UnmarshalTOML(map[string]interface{}{"A": "A", "MY.VAR": "x"})
+	if err != nil {
+		t.Fatalf("error in UnmarshalTOML(): %v", err)
+	}
+
+	if !reflect.DeepEqual(env.AsSlice(), []string{"A=A", "MY.VAR=x"}) {
+		t.Fatalf("unexpected slice: %v", env.AsSlice())
+	}
+
+	if err = env.UnmarshalTOML(map[string]interface{}{"A": int64(1)}); err == nil {
+		t.Fatalf("expected an error for a non-string value")
+	}
+
+	if err = env.UnmarshalTOML("A=A"); err == nil {
+		t.Fatalf("expected an error for a non-table")
+	}
+}
@@ -0,0 +1,99 @@
+package environ
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// ErrNotSet is wrapped by the errors of the typed getters when the
+// requested key is missing.
+var ErrNotSet = errors.New("variable not set")
+
+// GetInt retrieves the value under key parsed with strconv.Atoi.
+//
+// The error names the key, and wraps ErrNotSet if the key is missing or the
+// strconv error if the value doesn't parse.
+func (e *Environ) GetInt(key string) (int, error) {
+	v, err := e.getRequired(key)
+	if err != nil {
+		return 0, err
+	}
+
+	i, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", key, err)
+	}
+
+	return i, nil
+}
+
+// GetBool retrieves the value under key parsed with strconv.ParseBool,
+// which accepts 1, t, T, TRUE, true, True, 0, f, F, FALSE, false and
+// False.
+//
+// The error names the key, and wraps ErrNotSet if the key is missing or the
+// strconv error if the value doesn't parse.
+func (e *Environ) GetBool(key string) (bool, error) {
+	v, err := e.getRequired(key)
+	if err != nil {
+		return false, err
+	}
+
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", key, err)
+	}
+
+	return b, nil
+}
+
+// GetDuration retrieves the value under key parsed with
+// time.ParseDuration.
+//
+// The error names the key, and wraps ErrNotSet if the key is missing or the
+// time error if the value doesn't parse.
+func (e *Environ) GetDuration(key string) (time.Duration, error) {
+	v, err := e.getRequired(key)
+	if err != nil {
+		return 0, err
+	}
+
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", key, err)
+	}
+
+	return d, nil
+}
+
+func (e *Environ) getRequired(key string) (string, error) {
+	v, ok := e.GetOK(key)
+	if !ok {
+		return "", fmt.Errorf("%s: %w", key, ErrNotSet)
+	}
+
+	return v, nil
+}
+
+// Decode retrieves the value under key and converts it with parse, for
+// types the typed getters don't cover.
+//
+// The error names the key, and wraps ErrNotSet if the key is missing or the
+// error from parse if the value doesn't parse.
+func Decode[T any](e *Environ, key string, parse func(string) (T, error)) (T, error) {
+	var zero T
+
+	v, err := e.getRequired(key)
+	if err != nil {
+		return zero, err
+	}
+
+	t, err := parse(v)
+	if err != nil {
+		return zero, fmt.Errorf("%s: %w", key, err)
+	}
+
+	return t, nil
+}
@@ -0,0 +1,92 @@
+package environ_test
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/metrumresearchgroup/environ"
+)
+
+func TestTypedGetters(t *testing.T) {
+	env := environ.New([]string{"INT=42", "BOOL=T", "DURATION=1m30s", "BAD=nope"})
+
+	i, err := env.GetInt("INT")
+	if err != nil || i != 42 {
+		t.Fatalf("GetInt: %d, %v", i, err)
+	}
+
+	b, err := env.GetBool("BOOL")
+	if err != nil || !b {
+		t.Fatalf("GetBool: %v, %v", b, err)
+	}
+
+	d, err := env.GetDuration("DURATION")
+	if err != nil || d != 90*time.Second {
+		t.Fatalf("GetDuration: %v, %v", d, err)
+	}
+}
+
+func TestTypedGettersErrors(t *testing.T) {
+	env := environ.New([]string{"BAD=nope"})
+
+	getters := map[string]func(string) error{
+		"GetInt": func(key string) error {
+			_, err := env.GetInt(key)
+
+			return err
+		},
+		"GetBool": func(key string) error {
+			_, err := env.GetBool(key)
+
+			return err
+		},
+		"GetDuration": func(key string) error {
+			_, err := env.GetDuration(key)
+
+			return err
+		},
+	}
+
+	for name, get := range getters {
+		err := get("MISSING")
+		if !errors.Is(err, environ.ErrNotSet) || !strings.Contains(err.Error(), "MISSING") {
+			t.Fatalf("%s: unexpected error for missing key: %v", name, err)
+		}
+
+		err = get("BAD")
+		if err == nil || !strings.Contains(err.Error(), "BAD") {
+			t.Fatalf("%s: unexpected error for bad value: %v", name, err)
+		}
+	}
+
+	_, err := env.GetInt("BAD")
+	if !errors.Is(err, strconv.ErrSyntax) {
+		t.Fatalf("expected wrapped strconv.ErrSyntax, got: %v", err)
+	}
+}
+
+func TestDecode(t *testing.T) {
+	env := environ.New([]string{"RATIO=0.25", "BAD=nope"})
+
+	parseFloat := func(s string) (float64, error) {
+		return strconv.ParseFloat(s, 64)
+	}
+
+	f, err := environ.Decode(env, "RATIO", parseFloat)
+	if err != nil || f != 0.25 {
+		t.Fatalf("unexpected result: %v, %v", f, err)
+	}
+
+	_, err = environ.Decode(env, "MISSING", parseFloat)
+	if !errors.Is(err, environ.ErrNotSet) || !strings.Contains(err.Error(), "MISSING") {
+		t.Fatalf("unexpected error for missing key: %v", err)
+	}
+
+	f, err = environ.Decode(env, "BAD", parseFloat)
+	if !errors.Is(err, strconv.ErrSyntax) || !strings.Contains(err.Error(), "BAD") || f != 0 {
+		t.Fatalf("unexpected error for bad value: %v, %v", f, err)
+	}
+}
@@ -0,0 +1,80 @@
+package environ
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrInvalidKey is wrapped by errors reporting a key which isn't a valid
+// environment variable name.
+var ErrInvalidKey = errors.New("invalid variable name")
+
+// ValidKey reports whether key is a valid POSIX environment variable name:
+// letters, digits and underscores, not starting with a digit.
+func ValidKey(key string) bool {
+	if key == "" {
+		return false
+	}
+
+	for i, r := range key {
+		switch {
+		case r == '_', r >= 'A' && r <= 'Z', r >= 'a' && r <= 'z':
+		case r >= '0' && r <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+// SetStrict behaves like Set, but first checks key with ValidKey, returning
+// an error wrapping ErrInvalidKey and leaving the Environ unchanged if it
+// isn't a valid name.
+func (e *Environ) SetStrict(key, val string) error {
+	if !ValidKey(key) {
+		return fmt.Errorf("%q: %w", key, ErrInvalidKey)
+	}
+
+	e.Set(key, val)
+
+	return nil
+}
+
+// TrySet behaves like Set, but returns an error wrapping ErrInvalidKey and
+// leaves the Environ unchanged if key contains an "=". Such a key can't
+// survive AsSlice: "A=B" set to "C" is emitted as "A=B=C", which parses
+// back as "A" set to "B=C".
+//
+// Unlike SetStrict, any other key is accepted.
+func (e *Environ) TrySet(key, val string) error {
+	if strings.Contains(key, "=") {
+		return fmt.Errorf("%q contains \"=\": %w", key, ErrInvalidKey)
+	}
+
+	e.Set(key, val)
+
+	return nil
+}
+
+// UnmarshalJSONStrict behaves like UnmarshalJSON, but checks every key with
+// ValidKey. If any is invalid it returns an error wrapping ErrInvalidKey
+// naming the first such key in lexical order, and leaves the Environ
+// unchanged.
+func (e *Environ) UnmarshalJSONStrict(data []byte) error {
+	m, err := unmarshalJSONMap(data)
+	if err != nil {
+		return err
+	}
+
+	for _, k := range keys(m) {
+		if !ValidKey(k) {
+			return fmt.Errorf("%q: %w", k, ErrInvalidKey)
+		}
+	}
+
+	e.replace(m)
+
+	return nil
+}
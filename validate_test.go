@@ -0,0 +1,100 @@
+package environ_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/metrumresearchgroup/environ"
+)
+
+func TestValidKey(t *testing.T) {
+	for key, want := range map[string]bool{
+		"PATH":     true,
+		"_private": true,
+		"a1_B2":    true,
+		"":         false,
+		"1ABC":     false,
+		"A=B":      false,
+		"MY VAR":   false,
+		"MY.VAR":   false,
+		"MY-VAR":   false,
+		"ÄPFEL":    false,
+	} {
+		if got := environ.ValidKey(key); got != want {
+			t.Fatalf("ValidKey(%q) = %v, expected %v", key, got, want)
+		}
+	}
+}
+
+func TestSetStrict(t *testing.T) {
+	env := environ.New(nil)
+
+	if err := env.SetStrict("GOOD_KEY", "value"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, key := range []string{"A=B", "MY VAR", "9LIVES"} {
+		if err := env.SetStrict(key, "value"); !errors.Is(err, environ.ErrInvalidKey) {
+			t.Fatalf("expected ErrInvalidKey for %q, got: %v", key, err)
+		}
+	}
+
+	if !reflect.DeepEqual(env.AsSlice(), []string{"GOOD_KEY=value"}) {
+		t.Fatalf("unexpected slice: %v", env.AsSlice())
+	}
+}
+
+func TestTrySet(t *testing.T) {
+	env := environ.New(nil)
+
+	// demonstrate the corruption TrySet guards against.
+	env.Set("A=B", "C")
+	if reparsed := environ.New(env.AsSlice()); !reflect.DeepEqual(reparsed.AsMap(), map[string]string{"A": "B=C"}) {
+		t.Fatalf("expected the key to be corrupted by a round trip, got: %v", reparsed.AsMap())
+	}
+
+	env.Clear()
+
+	if err := env.TrySet("A=B", "C"); !errors.Is(err, environ.ErrInvalidKey) {
+		t.Fatalf("expected ErrInvalidKey, got: %v", err)
+	}
+
+	if err := env.TrySet("MY.VAR", "C"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !reflect.DeepEqual(environ.New(env.AsSlice()).AsSlice(), []string{"MY.VAR=C"}) {
+		t.Fatalf("unexpected round trip: %v", env.AsSlice())
+	}
+}
+
+func TestUnmarshalJSONStrict(t *testing.T) {
+	env := environ.New([]string{"KEEP=keep"})
+
+	for _, data := range []string{
+		`["A=A", "BAD KEY=x", "=empty"]`,
+		`{"A": "A", "B=C": "x"}`,
+	} {
+		err := env.UnmarshalJSONStrict([]byte(data))
+		if !errors.Is(err, environ.ErrInvalidKey) {
+			t.Fatalf("expected ErrInvalidKey for %s, got: %v", data, err)
+		}
+
+		if !reflect.DeepEqual(env.AsSlice(), []string{"KEEP=keep"}) {
+			t.Fatalf("environ was modified: %v", env.AsSlice())
+		}
+	}
+
+	if err := env.UnmarshalJSONStrict([]byte(`["A=A", "B_2=B"]`)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !reflect.DeepEqual(env.AsSlice(), []string{"A=A", "B_2=B"}) {
+		t.Fatalf("unexpected slice: %v", env.AsSlice())
+	}
+
+	if err := env.UnmarshalJSONStrict([]byte(`{`)); err == nil || errors.Is(err, environ.ErrInvalidKey) {
+		t.Fatalf("expected a syntax error, got: %v", err)
+	}
+}
@@ -0,0 +1,28 @@
+package environ
+
+// The methods in this file satisfy the Marshaler and Unmarshaler interfaces
+// of gopkg.in/yaml.v2 and gopkg.in/yaml.v3 without importing either, so the
+// package doesn't depend on a YAML library.
+
+// MarshalYAML satisfies the yaml.Marshaler interface, representing the
+// Environ as a mapping of keys to string values.
+func (e *Environ) MarshalYAML() (interface{}, error) {
+	return e.AsMap(), nil
+}
+
+// UnmarshalYAML satisfies the yaml.Unmarshaler interface, reading a mapping
+// of keys to string values.
+func (e *Environ) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var m map[string]string
+	if err := unmarshal(&m); err != nil {
+		return err
+	}
+
+	if m == nil {
+		m = make(map[string]string)
+	}
+
+	e.replace(m)
+
+	return nil
+}
@@ -0,0 +1,57 @@
+package environ_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/metrumresearchgroup/environ"
+)
+
+func TestMarshalUnmarshalYAML(t *testing.T) {
+	orig := environ.New([]string{"A=A", "B=", "C=C=C"})
+
+	marshaled, err := orig.MarshalYAML()
+	if err != nil {
+		t.Fatalf("error in MarshalYAML(): %v", err)
+	}
+
+	want := map[string]string{"A": "A", "B": "", "C": "C=C"}
+	if !reflect.DeepEqual(marshaled, want) {
+		t.Fatalf("unexpected marshaled value: %#v", marshaled)
+	}
+
+	// stand in for a YAML decoder handing over the decoded mapping.
+	unmarshal := func(v interface{}) error {
+		data, err := json.Marshal(marshaled)
+		if err != nil {
+			return err
+		}
+
+		return json.Unmarshal(data, v)
+	}
+
+	unmarshaled := new(environ.Environ)
+	if err = unmarshaled.UnmarshalYAML(unmarshal); err != nil {
+		t.Fatalf("error in UnmarshalYAML(): %v", err)
+	}
+
+	if !reflect.DeepEqual(orig.AsSlice(), unmarshaled.AsSlice()) {
+		t.Fatalf("expected orig to match unmarshaled, orig: %v, unmarshaled: %v", orig.AsSlice(), unmarshaled.AsSlice())
+	}
+}
+
+func TestUnmarshalYAMLFailure(t *testing.T) {
+	env := environ.New([]string{"A=A"})
+
+	err := env.UnmarshalYAML(func(v interface{}) error {
+		return json.Unmarshal([]byte(`["A=A"]`), v)
+	})
+	if err == nil {
+		t.Fatalf("nil err")
+	}
+
+	if !reflect.DeepEqual(env.AsSlice(), []string{"A=A"}) {
+		t.Fatalf("environ was modified: %v", env.AsSlice())
+	}
+}